@@ -0,0 +1,79 @@
+package cache
+
+import "sync"
+
+// InvalidationBus broadcasts invalidations to all instances (e.g. replicas behind a load-balancer)
+// invalidations are delivered to all subscribers, including the ones of the publishing instance
+type InvalidationBus interface {
+	Publish(invalidation Invalidation) error
+	// Subscribe to all invalidations, the returned function cancels the subscription
+	Subscribe(onInvalidation func(invalidation Invalidation)) func()
+}
+
+// the cache applies all invalidations which were published by other instances (origin identifies this one)
+func WithInvalidationBus(bus InvalidationBus, origin string) CacheOption {
+	return func(c *Cache) {
+		c.unsubscribe = bus.Subscribe(func(invalidation Invalidation) {
+			if invalidation.Origin != origin {
+				c.Invalidate(invalidation)
+			}
+		})
+	}
+}
+
+// subscribers of a bus
+type subscribers struct {
+	mu        *sync.RWMutex
+	callbacks map[int]func(Invalidation)
+	next      int
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{
+		mu:        &sync.RWMutex{},
+		callbacks: map[int]func(Invalidation){},
+	}
+}
+
+func (s *subscribers) subscribe(onInvalidation func(Invalidation)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.next
+	s.next++
+	s.callbacks[id] = onInvalidation
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.callbacks, id)
+	}
+}
+
+func (s *subscribers) deliver(invalidation Invalidation) {
+	s.mu.RLock()
+	callbacks := make([]func(Invalidation), 0, len(s.callbacks))
+	for _, callback := range s.callbacks {
+		callbacks = append(callbacks, callback)
+	}
+	s.mu.RUnlock()
+	for _, callback := range callbacks {
+		callback(invalidation)
+	}
+}
+
+// NewMemoryBus is an in-process bus, it can be shared between multiple instances to simulate replicas (e.g. in tests)
+func NewMemoryBus() InvalidationBus {
+	return &memoryBus{subscribers: newSubscribers()}
+}
+
+type memoryBus struct {
+	subscribers *subscribers
+}
+
+func (b *memoryBus) Publish(invalidation Invalidation) error {
+	b.subscribers.deliver(invalidation)
+	return nil
+}
+
+func (b *memoryBus) Subscribe(onInvalidation func(Invalidation)) func() {
+	return b.subscribers.subscribe(onInvalidation)
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// invalidations are published on the request path, a hanging peer must not block it for long
+const defaultHTTPBusTimeout = 5 * time.Second
+
+// HTTPBus posts invalidations to a static list of peers
+// every instance has to serve the bus (it is an http.Handler) under the URL which is configured at its peers, e.g.
+//
+//	u.ServeMux().Handle("/uhttp/cache/invalidations", bus)
+//
+// the handler does not authenticate peers, it should not be reachable from the outside
+type HTTPBus struct {
+	peers       []string
+	client      *http.Client
+	subscribers *subscribers
+}
+
+// NewHTTPBus with the URLs of all peers (excluding this instance), a client with a timeout of 5s is used if client is nil
+func NewHTTPBus(peers []string, client *http.Client) *HTTPBus {
+	if client == nil {
+		client = &http.Client{Timeout: defaultHTTPBusTimeout}
+	}
+	return &HTTPBus{
+		peers:       peers,
+		client:      client,
+		subscribers: newSubscribers(),
+	}
+}
+
+// Publish to all subscribers of this instance and all peers (in parallel), errors of all peers are joined
+func (b *HTTPBus) Publish(invalidation Invalidation) error {
+	b.subscribers.deliver(invalidation)
+
+	body, err := json.Marshal(invalidation)
+	if err != nil {
+		return err
+	}
+	errs := make([]error, len(b.peers))
+	wg := sync.WaitGroup{}
+	for i, peer := range b.peers {
+		wg.Add(1)
+		go func(i int, peer string) {
+			defer wg.Done()
+			errs[i] = b.publishTo(peer, body)
+		}(i, peer)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (b *HTTPBus) publishTo(peer string, body []byte) error {
+	res, err := b.client.Post(peer, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not publish invalidation to %s (%s)", peer, err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("could not publish invalidation to %s (statusCode %d)", peer, res.StatusCode)
+	}
+	return nil
+}
+
+func (b *HTTPBus) Subscribe(onInvalidation func(Invalidation)) func() {
+	return b.subscribers.subscribe(onInvalidation)
+}
+
+// ServeHTTP receives invalidations from peers
+func (b *HTTPBus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	invalidation := Invalidation{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&invalidation); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	b.subscribers.deliver(invalidation)
+	w.WriteHeader(http.StatusNoContent)
+}
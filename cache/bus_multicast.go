@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+)
+
+// maximum size of an invalidation (a single UDP-datagram)
+const multicastMaxMessageSize = 8 * 1024
+
+// waiting time after failed reads (it doubles with every consecutive failure)
+const (
+	multicastMinBackoff = 10 * time.Millisecond
+	multicastMaxBackoff = 5 * time.Second
+)
+
+// MulticastBus sends invalidations as UDP-datagrams to a multicast-group (e.g. "239.0.0.42:9999")
+// delivery is not guaranteed, it is meant for instances within the same network
+type MulticastBus struct {
+	listener    *net.UDPConn
+	sender      *net.UDPConn
+	subscribers *subscribers
+}
+
+// NewMulticastBus joins the group, the bus needs to be closed to leave it again
+func NewMulticastBus(address string) (*MulticastBus, error) {
+	groupAddress, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.ListenMulticastUDP("udp4", nil, groupAddress)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := net.DialUDP("udp4", nil, groupAddress)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	b := &MulticastBus{
+		listener:    listener,
+		sender:      sender,
+		subscribers: newSubscribers(),
+	}
+	go b.receive()
+	return b, nil
+}
+
+func (b *MulticastBus) receive() {
+	buffer := make([]byte, multicastMaxMessageSize)
+	backoff := multicastMinBackoff
+	for {
+		n, _, err := b.listener.ReadFromUDP(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			// e.g. the network is down, retrying right away would spin
+			time.Sleep(backoff)
+			backoff = min(2*backoff, multicastMaxBackoff)
+			continue
+		}
+		backoff = multicastMinBackoff
+
+		invalidation := Invalidation{}
+		if err := json.Unmarshal(buffer[:n], &invalidation); err != nil {
+			continue
+		}
+		b.subscribers.deliver(invalidation)
+	}
+}
+
+// Publish to the group, the invalidation is received by this instance as well (via the group)
+func (b *MulticastBus) Publish(invalidation Invalidation) error {
+	message, err := json.Marshal(invalidation)
+	if err != nil {
+		return err
+	}
+	if len(message) > multicastMaxMessageSize {
+		return errors.New("invalidation is too large for multicast")
+	}
+	_, err = b.sender.Write(message)
+	return err
+}
+
+func (b *MulticastBus) Subscribe(onInvalidation func(Invalidation)) func() {
+	return b.subscribers.subscribe(onInvalidation)
+}
+
+func (b *MulticastBus) Close() error {
+	return errors.Join(b.listener.Close(), b.sender.Close())
+}
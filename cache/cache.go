@@ -1,13 +1,12 @@
 package cache
 
 import (
-	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
-	"sync"
+	"sync/atomic"
 	"time"
-	"unsafe"
 
 	"github.com/dunv/uhelpers"
 )
@@ -16,19 +15,94 @@ func NewCache(
 	maxAge time.Duration,
 	handlerPattern string,
 ) *Cache {
-	return &Cache{
-		mu:             &sync.RWMutex{},
+	return NewCacheWithStore(maxAge, handlerPattern, NewMemoryStore())
+}
+
+// NewCacheWithStore creates a cache which keeps its entries in the given store
+func NewCacheWithStore(
+	maxAge time.Duration,
+	handlerPattern string,
+	store Store,
+	opts ...CacheOption,
+) *Cache {
+	c := &Cache{
 		maxAge:         maxAge,
-		data:           map[string]CacheEntry{},
+		store:          store,
+		onError:        func(error) {},
+		onEvict:        func() {},
 		handlerPattern: handlerPattern,
+		usage:          newUsageTracker(),
+		evictions:      &atomic.Uint64{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.global != nil {
+		c.global.register(c)
+	}
+	return c
+}
+
+type CacheOption func(c *Cache)
+
+// errors of the store are passed to onError and treated as cache-misses
+func WithErrorHandler(onError func(err error)) CacheOption {
+	return func(c *Cache) {
+		c.onError = onError
+	}
+}
+
+// entries are evicted (according to the budget's policy) as soon as the budget is exceeded
+func WithBudget(budget Budget) CacheOption {
+	return func(c *Cache) {
+		c.budget = budget
+	}
+}
+
+// the cache is accounted for in a budget which is shared with other caches
+func WithGlobalBudget(global *GlobalBudget) CacheOption {
+	return func(c *Cache) {
+		c.global = global
+	}
+}
+
+// entries are kept for the given duration after they expired (e.g. to serve them while revalidating)
+func WithStaleRetention(retention time.Duration) CacheOption {
+	return func(c *Cache) {
+		c.staleRetention = retention
+	}
+}
+
+// onEvict is called for every evicted entry (not for expired or deleted ones)
+func WithEvictionHandler(onEvict func()) CacheOption {
+	return func(c *Cache) {
+		c.onEvict = onEvict
 	}
 }
 
 type Cache struct {
-	mu             *sync.RWMutex
 	maxAge         time.Duration
-	data           map[string]CacheEntry
+	staleRetention time.Duration
+	store          Store
+	onError        func(err error)
+	onEvict        func()
 	handlerPattern string
+
+	// budgets only apply to entries which were set by this instance
+	budget    Budget
+	global    *GlobalBudget
+	usage     *usageTracker
+	evictions *atomic.Uint64
+
+	// cancels the subscription of the invalidation bus (if any)
+	unsubscribe func()
+}
+
+// Close detaches the cache from the invalidation bus, the entries are kept
+func (c Cache) Close() {
+	if c.unsubscribe != nil {
+		c.unsubscribe()
+	}
 }
 
 func (c Cache) HandlerPattern() string {
@@ -39,10 +113,34 @@ func (c Cache) MaxAge() time.Duration {
 	return c.maxAge
 }
 
+// Retention is the time an entry is kept in total (maxAge and the time it can be served stale)
+func (c Cache) Retention() time.Duration {
+	return c.maxAge + c.staleRetention
+}
+
+// EntryMaxAge is the maxAge of the entry (it can be overridden per response)
+func (c Cache) EntryMaxAge(e CacheEntry) time.Duration {
+	if e.maxAge > 0 {
+		return e.maxAge
+	}
+	return c.maxAge
+}
+
+// EntryRetention is the Retention of the entry
+func (c Cache) EntryRetention(e CacheEntry) time.Duration {
+	return c.EntryMaxAge(e) + c.staleRetention
+}
+
+func (c Cache) Store() Store {
+	return c.store
+}
+
 func (c Cache) Set(
-	requestBody []byte,
-	requestParams string,
+	requestKey Key,
+	updatedOn time.Time,
+	maxAge time.Duration,
 	requestHeader http.Header,
+	tags []string,
 	responseModel interface{},
 	responseHeader http.Header,
 	responseStatusCode int,
@@ -50,27 +148,28 @@ func (c Cache) Set(
 	responseBodyBrotli []byte,
 	responseBodyGzip []byte,
 	responseBodyDeflate []byte,
+	responseBodyZstd []byte,
 ) {
-	key := hash(requestBody, requestParams)
-
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	key := requestKey.Hash()
 
 	// shorten things -> this way the cache cannot be overwhelmed by bombarding it with long
 	// requestParams or requestBodies
-	secureRequestBody := requestBody
+	secureRequestBody := requestKey.Body
 	if len(secureRequestBody) > 1000 {
-		secureRequestBody = requestBody[:1000]
+		secureRequestBody = secureRequestBody[:1000]
 	}
-	secureRequestParams := requestParams
-	if len(secureRequestParams) > 1000 {
-		secureRequestParams = requestParams[:1000]
+	description := requestKey.Describe()
+	if len(description.Params) > 1000 {
+		description.Params = description.Params[:1000]
 	}
 
 	e := CacheEntry{
-		updatedOn:           time.Now(),
-		requestParams:       secureRequestParams,
+		updatedOn:           updatedOn,
+		maxAge:              maxAge,
+		requestParams:       description.Params,
 		requestBody:         secureRequestBody,
+		key:                 description,
+		tags:                tags,
 		responseModel:       responseModel,
 		responseHeader:      responseHeader,
 		responseStatusCode:  responseStatusCode,
@@ -78,78 +177,138 @@ func (c Cache) Set(
 		responseBodyBrotli:  responseBodyBrotli,
 		responseBodyGzip:    responseBodyGzip,
 		responseBodyDeflate: responseBodyDeflate,
+		responseBodyZstd:    responseBodyZstd,
+	}
+
+	// computed once, so the budget accounts for the model as well
+	if responseBodyPlain != nil {
+		e.modelSize = uint64(len(responseBodyPlain))
+	} else if responseModel != nil {
+		if marshalled, err := json.Marshal(responseModel); err == nil {
+			e.modelSize = uint64(len(marshalled))
+		}
 	}
 
-	c.data[key] = e
+	c.put(key, e, c.EntryRetention(e))
 }
 
-func (c Cache) Keys() []string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// put stores the entry and enforces the budgets
+func (c Cache) put(key string, e CacheEntry, ttl time.Duration) {
+	if err := c.store.Set(key, e, ttl); err != nil {
+		c.onError(fmt.Errorf("could not set cache entry of %s (%s)", c.handlerPattern, err))
+		return
+	}
 
-	keys := []string{}
-	for key := range c.data {
-		keys = append(keys, key)
+	c.usage.add(key, e.EstimatedSize(), ttl)
+	c.enforceBudget(key)
+	if c.global != nil {
+		c.global.enforce(c.usage, key)
 	}
-	return keys
 }
 
-func (c Cache) Delete(key string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func (c Cache) Budget() Budget {
+	return c.budget
+}
+
+// Evictions since the cache was created
+func (c Cache) Evictions() uint64 {
+	return c.evictions.Load()
+}
+
+func (c Cache) enforceBudget(protected string) {
+	if !c.budget.limited() {
+		return
+	}
+	for c.budget.exceeded(c.usage.totals()) {
+		key, _, ok := c.usage.victim(c.budget.Policy, protected)
+		if !ok || !c.evict(key) {
+			return
+		}
+	}
+}
+
+// evict returns false if the entry was not tracked (anymore)
+func (c Cache) evict(key string) bool {
+	if !c.usage.remove(key) {
+		return false
+	}
+	if err := c.store.Delete(key); err != nil {
+		c.onError(fmt.Errorf("could not evict cache entry of %s (%s)", c.handlerPattern, err))
+	}
+	c.evictions.Add(1)
+	c.onEvict()
+	return true
+}
 
-	delete(c.data, key)
+func (c Cache) Keys() []string {
+	keys, err := c.store.Keys()
+	if err != nil {
+		c.onError(fmt.Errorf("could not list cache entries of %s (%s)", c.handlerPattern, err))
+		return []string{}
+	}
+	return keys
 }
 
-func (c Cache) Get(requestBody []byte, requestParams string) (CacheEntry, bool, string) {
-	key := hash(requestBody, requestParams)
+func (c Cache) Delete(key string) {
+	c.usage.remove(key)
+	if err := c.store.Delete(key); err != nil {
+		c.onError(fmt.Errorf("could not delete cache entry of %s (%s)", c.handlerPattern, err))
+	}
+}
 
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	if entry, ok := c.data[key]; ok {
-		val := entry.Clone()
-		return val, ok, key
+func (c Cache) Get(requestKey Key) (CacheEntry, bool, string) {
+	key := requestKey.Hash()
+	if entry, ok := c.GetByKey(key); ok {
+		// only requests count as usage (not maintenance like the TTL enforcer or admin handlers)
+		c.usage.touch(key)
+		return entry, ok, key
 	}
+	// the store might have expired or dropped the entry on its own
+	c.usage.remove(key)
 	return CacheEntry{}, false, ""
 }
 
 func (c Cache) GetByKey(key string) (CacheEntry, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	if entry, ok := c.data[key]; ok {
-		val := entry.Clone()
-		return val, ok
+	entry, ok, err := c.store.Get(key)
+	if err != nil {
+		c.onError(fmt.Errorf("could not get cache entry of %s (%s)", c.handlerPattern, err))
+		return CacheEntry{}, false
 	}
-	return CacheEntry{}, false
+	return entry, ok
 }
 
 func (c Cache) Size() uint64 {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	total := uint64(0)
-	for _, entry := range c.data {
-		total += entry.EstimatedSize()
+	size, err := c.store.Size()
+	if err != nil {
+		c.onError(fmt.Errorf("could not determine cache size of %s (%s)", c.handlerPattern, err))
 	}
-	return total
+	return size
 }
 
 func (c Cache) Count() int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return len(c.data)
+	count, err := c.store.Count()
+	if err != nil {
+		c.onError(fmt.Errorf("could not count cache entries of %s (%s)", c.handlerPattern, err))
+	}
+	return count
 }
 
 type CacheEntry struct {
 	updatedOn           time.Time
+	maxAge              time.Duration
 	requestParams       string
 	requestBody         []byte
+	key                 KeyDescription
+	tags                []string
 	responseModel       interface{}
 	responseBodyPlain   []byte
 	responseBodyGzip    []byte
 	responseBodyBrotli  []byte
 	responseBodyDeflate []byte
+	responseBodyZstd    []byte
 	responseHeader      http.Header
 	responseStatusCode  int
+	modelSize           uint64
 }
 
 func (e CacheEntry) EstimatedSize() uint64 {
@@ -158,8 +317,19 @@ func (e CacheEntry) EstimatedSize() uint64 {
 	total += uint64(len(e.responseBodyBrotli))
 	total += uint64(len(e.responseBodyGzip))
 	total += uint64(len(e.responseBodyDeflate))
-	total += uint64(unsafe.Sizeof(e.responseModel))
-	// total += uint64(reflect.Indirect(reflect.ValueOf(entry.responseModel)).Type().Size())
+	total += uint64(len(e.responseBodyZstd))
+	total += uint64(len(e.requestBody))
+	total += uint64(len(e.requestParams))
+	total += e.modelSize
+	for _, tag := range e.tags {
+		total += uint64(len(tag))
+	}
+	for key, values := range e.responseHeader {
+		total += uint64(len(key))
+		for _, value := range values {
+			total += uint64(len(value))
+		}
+	}
 	return total
 }
 
@@ -188,17 +358,28 @@ func (e *CacheEntry) Clone() CacheEntry {
 		copy(responseBodyDeflateCopy, e.responseBodyDeflate)
 	}
 
+	var responseBodyZstdCopy []byte
+	if e.responseBodyZstd != nil {
+		responseBodyZstdCopy = make([]byte, len(e.responseBodyZstd))
+		copy(responseBodyZstdCopy, e.responseBodyZstd)
+	}
+
 	return CacheEntry{
 		updatedOn:           e.updatedOn,
+		maxAge:              e.maxAge,
 		requestParams:       e.requestParams,
 		requestBody:         e.requestBody,
+		key:                 e.key,
+		tags:                append([]string(nil), e.tags...),
 		responseModel:       e.responseModel,
 		responseBodyPlain:   responseBodyPlainCopy,
 		responseBodyGzip:    responseBodyGzipCopy,
 		responseBodyBrotli:  responseBodyBrotliCopy,
 		responseBodyDeflate: responseBodyDeflateCopy,
+		responseBodyZstd:    responseBodyZstdCopy,
 		responseHeader:      e.responseHeader.Clone(),
 		responseStatusCode:  e.responseStatusCode,
+		modelSize:           e.modelSize,
 	}
 }
 
@@ -206,6 +387,29 @@ func (e *CacheEntry) UpdatedOn() time.Time {
 	return e.updatedOn
 }
 
+// MaxAge of this entry, 0 if the cache's maxAge applies
+func (e *CacheEntry) MaxAge() time.Duration {
+	return e.maxAge
+}
+
+// Key describes what the key of the entry was built from
+func (e *CacheEntry) Key() KeyDescription {
+	return e.key
+}
+
+func (e *CacheEntry) Tags() []string {
+	return e.tags
+}
+
+func (e *CacheEntry) HasTag(tag string) bool {
+	for _, entryTag := range e.tags {
+		if entryTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *CacheEntry) ResponseModel() interface{} {
 	return e.responseModel
 }
@@ -226,6 +430,10 @@ func (e *CacheEntry) ResponseBodyDeflate() []byte {
 	return e.responseBodyDeflate
 }
 
+func (e *CacheEntry) ResponseBodyZstd() []byte {
+	return e.responseBodyZstd
+}
+
 func (e *CacheEntry) ResponseHeader() http.Header {
 	return e.responseHeader
 }
@@ -257,8 +465,12 @@ type CacheEntryStats struct {
 	CachedBodyBrotli   bool       `json:"cachedBodyBrotli"`
 	CachedBodyGzip     bool       `json:"cachedBodyGzip"`
 	CachedBodyDeflate  bool       `json:"cachedBodyDeflate"`
+	CachedBodyZstd     bool       `json:"cachedBodyZstd"`
 	RequestParams      url.Values `json:"requestParams"`
 	RequestBody        string     `json:"requestBody"`
+	// what the key of the entry was built from
+	Key  KeyDescription `json:"key"`
+	Tags []string       `json:"tags,omitempty"`
 }
 
 func (e CacheEntry) Stats(c *Cache) (CacheEntryStats, error) {
@@ -268,7 +480,7 @@ func (e CacheEntry) Stats(c *Cache) (CacheEntryStats, error) {
 	}
 	return CacheEntryStats{
 		UpdatedOn:          e.updatedOn.Format(time.RFC3339),
-		TTL:                time.Until(e.updatedOn.Add(c.maxAge)).Round(time.Second).String(),
+		TTL:                time.Until(e.updatedOn.Add(c.EntryMaxAge(e))).Round(time.Second).String(),
 		EstimatedSize:      uhelpers.FormatByteCountIEC(int64(e.EstimatedSize())),
 		EstimatedSizeBytes: e.EstimatedSize(),
 		StatusCode:         e.responseStatusCode,
@@ -277,13 +489,10 @@ func (e CacheEntry) Stats(c *Cache) (CacheEntryStats, error) {
 		CachedBodyBrotli:   e.responseBodyBrotli != nil,
 		CachedBodyGzip:     e.responseBodyGzip != nil,
 		CachedBodyDeflate:  e.responseBodyDeflate != nil,
+		CachedBodyZstd:     e.responseBodyZstd != nil,
 		RequestParams:      queryParams,
 		RequestBody:        string(e.requestBody),
+		Key:                e.key,
+		Tags:               e.tags,
 	}, nil
 }
-
-func hash(body []byte, params string) string {
-	uniqueString := fmt.Sprintf("%s-%s", body, params)
-	s := md5.Sum([]byte(uniqueString))
-	return fmt.Sprintf("%x", s)
-}
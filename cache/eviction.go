@@ -0,0 +1,294 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type EvictionPolicy string
+
+const (
+	// evict the least recently used entry
+	EVICTION_LRU EvictionPolicy = "lru"
+	// evict the least frequently used entry (ties are broken by recency)
+	EVICTION_LFU EvictionPolicy = "lfu"
+)
+
+// Budget of a cache, zero values are unlimited
+type Budget struct {
+	MaxBytes   uint64
+	MaxEntries int
+	Policy     EvictionPolicy
+}
+
+func (b Budget) exceeded(bytes uint64, entries int) bool {
+	return (b.MaxBytes > 0 && bytes > b.MaxBytes) || (b.MaxEntries > 0 && entries > b.MaxEntries)
+}
+
+func (b Budget) limited() bool {
+	return b.MaxBytes > 0 || b.MaxEntries > 0
+}
+
+// usage of a single entry
+type usage struct {
+	size       uint64
+	lastAccess uint64
+	hits       uint64
+}
+
+// less is true if a should be evicted before b
+func (a usage) less(b usage, policy EvictionPolicy) bool {
+	if policy == EVICTION_LFU && a.hits != b.hits {
+		return a.hits < b.hits
+	}
+	return a.lastAccess < b.lastAccess
+}
+
+// trackedEntry is part of all structures of the usageTracker
+type trackedEntry struct {
+	key   string
+	usage usage
+	// zero: the entry does not expire
+	expiresAt time.Time
+
+	recency        *list.Element
+	frequencyIndex int
+	expiryIndex    int
+}
+
+// usageTracker keeps track of the entries of one cache which were set by this instance
+// - recency: most recently used entries first (LRU)
+// - frequency: min-heap by hits and recency (LFU)
+// - expiry: min-heap by expiration, entries which the store expires on its own are dropped from the tracker
+// so finding a victim does not depend on the number of entries
+type usageTracker struct {
+	mu        *sync.Mutex
+	entries   map[string]*trackedEntry
+	recency   *list.List
+	frequency *entryHeap
+	expiry    *entryHeap
+	bytes     uint64
+}
+
+// logical clock, so accesses within the same time-resolution can still be ordered (also across caches)
+var accessClock atomic.Uint64
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{
+		mu:      &sync.Mutex{},
+		entries: map[string]*trackedEntry{},
+		recency: list.New(),
+		frequency: &entryHeap{
+			less:  func(a, b *trackedEntry) bool { return a.usage.less(b.usage, EVICTION_LFU) },
+			index: func(e *trackedEntry) *int { return &e.frequencyIndex },
+		},
+		expiry: &entryHeap{
+			less:  func(a, b *trackedEntry) bool { return a.expiresAt.Before(b.expiresAt) },
+			index: func(e *trackedEntry) *int { return &e.expiryIndex },
+		},
+	}
+}
+
+// add an entry which is expected to expire in the store after ttl (0: never)
+func (t *usageTracker) add(key string, size uint64, ttl time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(key)
+
+	entry := &trackedEntry{
+		key:   key,
+		usage: usage{size: size, lastAccess: accessClock.Add(1), hits: 1},
+	}
+	entry.recency = t.recency.PushFront(entry)
+	heap.Push(t.frequency, entry)
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+		heap.Push(t.expiry, entry)
+	} else {
+		entry.expiryIndex = -1
+	}
+	t.entries[key] = entry
+	t.bytes += size
+}
+
+func (t *usageTracker) touch(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if entry, ok := t.entries[key]; ok {
+		entry.usage.lastAccess = accessClock.Add(1)
+		entry.usage.hits++
+		t.recency.MoveToFront(entry.recency)
+		heap.Fix(t.frequency, entry.frequencyIndex)
+	}
+}
+
+func (t *usageTracker) remove(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.removeLocked(key)
+}
+
+func (t *usageTracker) removeLocked(key string) bool {
+	entry, ok := t.entries[key]
+	if !ok {
+		return false
+	}
+	t.bytes -= entry.usage.size
+	delete(t.entries, key)
+	t.recency.Remove(entry.recency)
+	heap.Remove(t.frequency, entry.frequencyIndex)
+	if entry.expiryIndex >= 0 {
+		heap.Remove(t.expiry, entry.expiryIndex)
+	}
+	return true
+}
+
+// pruneExpired drops all entries which the store has expired already
+func (t *usageTracker) pruneExpired(now time.Time) {
+	for t.expiry.Len() > 0 && !t.expiry.entries[0].expiresAt.After(now) {
+		t.removeLocked(t.expiry.entries[0].key)
+	}
+}
+
+// totals of the entries which have not expired
+func (t *usageTracker) totals() (uint64, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pruneExpired(time.Now())
+	return t.bytes, len(t.entries)
+}
+
+// victim returns the entry which should be evicted next according to the policy
+// the protected entry (the one which was just set) is only returned if there is nothing else,
+// otherwise LFU would always evict new entries right away
+func (t *usageTracker) victim(policy EvictionPolicy, protected string) (string, usage, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.entries) == 0 {
+		return "", usage{}, false
+	}
+
+	var victim *trackedEntry
+	if policy == EVICTION_LFU {
+		// the second smallest element of a heap is one of the children of the root
+		victim = t.frequency.entries[0]
+		if victim.key == protected {
+			for _, i := range []int{1, 2} {
+				if i < t.frequency.Len() && (victim.key == protected || t.frequency.less(t.frequency.entries[i], victim)) {
+					victim = t.frequency.entries[i]
+				}
+			}
+		}
+	} else {
+		element := t.recency.Back()
+		if element.Value.(*trackedEntry).key == protected && element.Prev() != nil {
+			element = element.Prev()
+		}
+		victim = element.Value.(*trackedEntry)
+	}
+	return victim.key, victim.usage, true
+}
+
+// entryHeap implements heap.Interface, the position of every entry is kept in the entry itself
+type entryHeap struct {
+	entries []*trackedEntry
+	less    func(a, b *trackedEntry) bool
+	index   func(e *trackedEntry) *int
+}
+
+func (h *entryHeap) Len() int { return len(h.entries) }
+
+func (h *entryHeap) Less(i, j int) bool { return h.less(h.entries[i], h.entries[j]) }
+
+func (h *entryHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	*h.index(h.entries[i]) = i
+	*h.index(h.entries[j]) = j
+}
+
+func (h *entryHeap) Push(x any) {
+	entry := x.(*trackedEntry)
+	*h.index(entry) = len(h.entries)
+	h.entries = append(h.entries, entry)
+}
+
+func (h *entryHeap) Pop() any {
+	last := h.entries[len(h.entries)-1]
+	h.entries[len(h.entries)-1] = nil
+	h.entries = h.entries[:len(h.entries)-1]
+	*h.index(last) = -1
+	return last
+}
+
+// A budget which is shared by multiple caches (e.g. all caches of a server)
+// if it is exceeded, the victim is chosen across all registered caches
+type GlobalBudget struct {
+	mu     *sync.Mutex
+	budget Budget
+	caches []*Cache
+}
+
+func NewGlobalBudget(budget Budget) *GlobalBudget {
+	return &GlobalBudget{
+		mu:     &sync.Mutex{},
+		budget: budget,
+	}
+}
+
+func (g *GlobalBudget) Budget() Budget {
+	return g.budget
+}
+
+func (g *GlobalBudget) register(c *Cache) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.caches = append(g.caches, c)
+}
+
+// enforce the budget after the protected entry was set in the cache with the given usage
+func (g *GlobalBudget) enforce(protectedUsage *usageTracker, protected string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for {
+		totalBytes, totalEntries := uint64(0), 0
+		for _, c := range g.caches {
+			bytes, entries := c.usage.totals()
+			totalBytes += bytes
+			totalEntries += entries
+		}
+		if !g.budget.exceeded(totalBytes, totalEntries) {
+			return
+		}
+
+		var victimCache, protectedCache *Cache
+		var victimKey string
+		var victimUsage usage
+		for _, c := range g.caches {
+			key, keyUsage, ok := c.usage.victim(g.budget.Policy, "")
+			if c.usage == protectedUsage {
+				protectedCache = c
+				// the protected entry is only evicted if it is the last one
+				if key, keyUsage, ok = c.usage.victim(g.budget.Policy, protected); key == protected {
+					continue
+				}
+			}
+			if ok && (victimCache == nil || keyUsage.less(victimUsage, g.budget.Policy)) {
+				victimCache, victimKey, victimUsage = c, key, keyUsage
+			}
+		}
+
+		evicted := false
+		if victimCache != nil {
+			evicted = victimCache.evict(victimKey)
+		} else if protectedCache != nil {
+			evicted = protectedCache.evict(protected)
+		}
+		if !evicted {
+			return
+		}
+	}
+}
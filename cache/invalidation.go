@@ -0,0 +1,59 @@
+package cache
+
+import "path"
+
+// Invalidation of entries, all set fields have to match (an empty invalidation matches everything)
+type Invalidation struct {
+	// handlerPattern or path.Match-pattern (e.g. "/users/*")
+	Pattern string `json:"pattern,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+	// instance which published the invalidation (it was applied there already)
+	Origin string `json:"origin,omitempty"`
+}
+
+// MatchesPattern is true if the handlerPattern of the cache is the pattern or matches it (see path.Match)
+func (c Cache) MatchesPattern(pattern string) bool {
+	if pattern == c.handlerPattern {
+		return true
+	}
+	matched, _ := path.Match(pattern, c.handlerPattern)
+	return matched
+}
+
+// Invalidate deletes all matching entries and returns how many were deleted
+func (c Cache) Invalidate(invalidation Invalidation) int {
+	if invalidation.Pattern != "" && !c.MatchesPattern(invalidation.Pattern) {
+		return 0
+	}
+	return c.InvalidateWhere(func(key string, entry CacheEntry) bool {
+		return (invalidation.Key == "" || invalidation.Key == key) &&
+			(invalidation.Tag == "" || entry.HasTag(invalidation.Tag))
+	})
+}
+
+// InvalidateWhere deletes all entries for which the predicate is true and returns how many were deleted
+func (c Cache) InvalidateWhere(predicate func(key string, entry CacheEntry) bool) int {
+	deleted := 0
+	for _, key := range c.Keys() {
+		entry, ok := c.GetByKey(key)
+		if !ok || !predicate(key, entry) {
+			continue
+		}
+		c.Delete(key)
+		deleted++
+	}
+	return deleted
+}
+
+// InvalidateTags deletes all entries which have at least one of the tags
+func (c Cache) InvalidateTags(tags ...string) int {
+	return c.InvalidateWhere(func(_ string, entry CacheEntry) bool {
+		for _, tag := range tags {
+			if entry.HasTag(tag) {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// Everything a cached response depends on
+type Key struct {
+	// only set for methods other than GET (e.g. cached POST-queries)
+	Method string
+	// only relevant params (they are encoded sorted by key, so their order does not matter)
+	Params url.Values
+	Body   []byte
+	// only relevant headers (e.g. Authorization or Accept-Language)
+	Headers http.Header
+	Cookies map[string]string
+	// authenticated identity (if responses differ per user)
+	Principal string
+	// result of a custom key function
+	Custom string
+	// what the handler keys by (e.g. "header:Authorization"), only descriptive, it is not part of the hash
+	KeyedBy []string
+}
+
+// Hash of all parts, this is the key under which an entry is stored
+func (k Key) Hash() string {
+	h := md5.New()
+	// every part is length-prefixed, so parts cannot be confused with one another
+	writePart := func(name string, value string) {
+		_, _ = io.WriteString(h, fmt.Sprintf("%s:%d:%s;", name, len(value), value))
+	}
+
+	if k.Method != "" {
+		writePart("method", k.Method)
+	}
+	writePart("params", k.Params.Encode())
+	writePart("body", string(k.Body))
+	for _, name := range sortedKeys(k.Headers) {
+		for _, value := range k.Headers[name] {
+			writePart("header:"+http.CanonicalHeaderKey(name), value)
+		}
+	}
+	for _, name := range sortedKeys(k.Cookies) {
+		writePart("cookie:"+name, k.Cookies[name])
+	}
+	writePart("principal", k.Principal)
+	writePart("custom", k.Custom)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// What a key was built from, header- and cookie-values are only included as fingerprints
+// (they often contain credentials)
+type KeyDescription struct {
+	Method    string            `json:"method,omitempty"`
+	Params    string            `json:"params,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Cookies   map[string]string `json:"cookies,omitempty"`
+	Principal string            `json:"principal,omitempty"`
+	Custom    string            `json:"custom,omitempty"`
+	KeyedBy   []string          `json:"keyedBy,omitempty"`
+}
+
+func (k Key) Describe() KeyDescription {
+	description := KeyDescription{
+		Method:    k.Method,
+		Params:    k.Params.Encode(),
+		Principal: k.Principal,
+		Custom:    k.Custom,
+		KeyedBy:   k.KeyedBy,
+	}
+	if len(k.Headers) != 0 {
+		description.Headers = map[string]string{}
+		for name, values := range k.Headers {
+			description.Headers[http.CanonicalHeaderKey(name)] = fingerprint(fmt.Sprint(values))
+		}
+	}
+	if len(k.Cookies) != 0 {
+		description.Cookies = map[string]string{}
+		for name, value := range k.Cookies {
+			description.Cookies[name] = fingerprint(value)
+		}
+	}
+	return description
+}
+
+func fingerprint(value string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(value)))[:15]
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// version of the snapshot format, snapshots with another version (or another entry-version) are rejected
+const (
+	snapshotFormat  = "uhttp-cache-snapshot"
+	snapshotVersion = 1
+)
+
+// first value of a snapshot, followed by one snapshotEntry per cache entry
+type snapshotHeader struct {
+	Format         string    `json:"format"`
+	Version        int       `json:"version"`
+	EntryVersion   int       `json:"entryVersion"`
+	HandlerPattern string    `json:"handlerPattern"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type snapshotEntry struct {
+	Key   string          `json:"key"`
+	Entry json.RawMessage `json:"entry"`
+}
+
+// WriteSnapshot writes all entries (including encoded bodies) to w and returns how many were written
+// entries which cannot be serialized are skipped (and passed to the error handler)
+func (c Cache) WriteSnapshot(w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(snapshotHeader{
+		Format:         snapshotFormat,
+		Version:        snapshotVersion,
+		EntryVersion:   serializedEntryVersion,
+		HandlerPattern: c.handlerPattern,
+		CreatedAt:      time.Now(),
+	}); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for _, key := range c.Keys() {
+		entry, ok := c.GetByKey(key)
+		if !ok {
+			continue
+		}
+		data, err := marshalEntry(entry)
+		if err != nil {
+			c.onError(fmt.Errorf("could not snapshot cache entry of %s (%s)", c.handlerPattern, err))
+			continue
+		}
+		if err := encoder.Encode(snapshotEntry{Key: key, Entry: data}); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
+
+// LoadSnapshot restores the entries of a snapshot, expired entries are dropped
+// it returns how many entries were restored. Snapshots of other handlers or incompatible versions are rejected
+func (c Cache) LoadSnapshot(r io.Reader) (int, error) {
+	decoder := json.NewDecoder(r)
+	header := snapshotHeader{}
+	if err := decoder.Decode(&header); err != nil {
+		return 0, fmt.Errorf("could not read snapshot header (%s)", err)
+	}
+	if header.Format != snapshotFormat || header.Version != snapshotVersion || header.EntryVersion != serializedEntryVersion {
+		return 0, fmt.Errorf("incompatible snapshot (format:%s version:%d entryVersion:%d)", header.Format, header.Version, header.EntryVersion)
+	}
+	if header.HandlerPattern != c.handlerPattern {
+		return 0, fmt.Errorf("snapshot of %s cannot be loaded into the cache of %s", header.HandlerPattern, c.handlerPattern)
+	}
+
+	restored := 0
+	for {
+		snapshotted := snapshotEntry{}
+		if err := decoder.Decode(&snapshotted); errors.Is(err, io.EOF) {
+			return restored, nil
+		} else if err != nil {
+			return restored, fmt.Errorf("could not read snapshot entry (%s)", err)
+		}
+
+		entry, err := unmarshalEntry(snapshotted.Entry)
+		if err != nil {
+			return restored, err
+		}
+		remaining := c.EntryRetention(entry) - time.Since(entry.updatedOn)
+		if remaining <= 0 {
+			continue
+		}
+		c.put(snapshotted.Key, entry, remaining)
+		restored++
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// Storage backend of a cache, keys are already hashed and unique per handler
+type Store interface {
+	// Get an entry, a missing entry is not an error
+	Get(key string) (CacheEntry, bool, error)
+	// Set an entry, the ttl is a hint for stores which can expire entries on their own
+	Set(key string, entry CacheEntry, ttl time.Duration) error
+	Delete(key string) error
+	Keys() ([]string, error)
+	// Estimated size of all entries in bytes
+	Size() (uint64, error)
+	Count() (int, error)
+}
+
+// NewMemoryStore keeps all entries (including the responseModel by reference) in a map
+// this is the default store
+func NewMemoryStore() Store {
+	return &memoryStore{
+		mu:   &sync.RWMutex{},
+		data: map[string]CacheEntry{},
+	}
+}
+
+type memoryStore struct {
+	mu   *sync.RWMutex
+	data map[string]CacheEntry
+}
+
+func (s *memoryStore) Get(key string) (CacheEntry, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if entry, ok := s.data[key]; ok {
+		return entry.Clone(), true, nil
+	}
+	return CacheEntry{}, false, nil
+}
+
+func (s *memoryStore) Set(key string, entry CacheEntry, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = entry
+	return nil
+}
+
+func (s *memoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memoryStore) Keys() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := []string{}
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *memoryStore) Size() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	total := uint64(0)
+	for _, entry := range s.data {
+		total += entry.EstimatedSize()
+	}
+	return total, nil
+}
+
+func (s *memoryStore) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data), nil
+}
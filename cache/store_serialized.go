@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimal interface of a shared key-value store (e.g. redis or memcached)
+// which can be used by multiple replicas at the same time
+type BytesStore interface {
+	// Get a value, a missing value is not an error
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(key string) error
+	// Keys with the given prefix
+	Keys(prefix string) ([]string, error)
+}
+
+// NewSerializedStore keeps all entries serialized in a BytesStore
+// all keys are prefixed with the namespace, so one backend can be shared by all handlers (e.g. use the handlerPattern)
+// the responseModel is stored as JSON and returned as json.RawMessage
+func NewSerializedStore(backend BytesStore, namespace string) Store {
+	return &serializedStore{
+		backend: backend,
+		prefix:  namespace + ":",
+	}
+}
+
+type serializedStore struct {
+	backend BytesStore
+	prefix  string
+}
+
+// version of the serialized format, entries with another version are treated as missing
+const serializedEntryVersion = 1
+
+type serializedEntry struct {
+	Version             int             `json:"v"`
+	UpdatedOn           time.Time       `json:"updatedOn"`
+	MaxAge              time.Duration   `json:"maxAge,omitempty"`
+	RequestParams       string          `json:"requestParams"`
+	RequestBody         []byte          `json:"requestBody,omitempty"`
+	Key                 KeyDescription  `json:"key"`
+	Tags                []string        `json:"tags,omitempty"`
+	ResponseModel       json.RawMessage `json:"responseModel,omitempty"`
+	ResponseBodyPlain   []byte          `json:"responseBodyPlain,omitempty"`
+	ResponseBodyGzip    []byte          `json:"responseBodyGzip,omitempty"`
+	ResponseBodyBrotli  []byte          `json:"responseBodyBrotli,omitempty"`
+	ResponseBodyDeflate []byte          `json:"responseBodyDeflate,omitempty"`
+	ResponseBodyZstd    []byte          `json:"responseBodyZstd,omitempty"`
+	ResponseHeader      http.Header     `json:"responseHeader,omitempty"`
+	ResponseStatusCode  int             `json:"responseStatusCode"`
+}
+
+// marshalEntry serializes an entry (the responseModel is encoded as JSON)
+func marshalEntry(e CacheEntry) ([]byte, error) {
+	serialized := serializedEntry{
+		Version:             serializedEntryVersion,
+		UpdatedOn:           e.updatedOn,
+		MaxAge:              e.maxAge,
+		RequestParams:       e.requestParams,
+		RequestBody:         e.requestBody,
+		Key:                 e.key,
+		Tags:                e.tags,
+		ResponseBodyPlain:   e.responseBodyPlain,
+		ResponseBodyGzip:    e.responseBodyGzip,
+		ResponseBodyBrotli:  e.responseBodyBrotli,
+		ResponseBodyDeflate: e.responseBodyDeflate,
+		ResponseBodyZstd:    e.responseBodyZstd,
+		ResponseHeader:      e.responseHeader,
+		ResponseStatusCode:  e.responseStatusCode,
+	}
+	if e.responseModel != nil {
+		model, err := json.Marshal(e.responseModel)
+		if err != nil {
+			return nil, fmt.Errorf("could not serialize responseModel (%s)", err)
+		}
+		serialized.ResponseModel = model
+	}
+	return json.Marshal(serialized)
+}
+
+// unmarshalEntry is the counterpart of marshalEntry
+func unmarshalEntry(data []byte) (CacheEntry, error) {
+	serialized := serializedEntry{}
+	if err := json.Unmarshal(data, &serialized); err != nil {
+		return CacheEntry{}, fmt.Errorf("could not deserialize entry (%s)", err)
+	}
+	if serialized.Version != serializedEntryVersion {
+		return CacheEntry{}, fmt.Errorf("unsupported entry version %d (expected %d)", serialized.Version, serializedEntryVersion)
+	}
+	e := CacheEntry{
+		updatedOn:           serialized.UpdatedOn,
+		maxAge:              serialized.MaxAge,
+		requestParams:       serialized.RequestParams,
+		requestBody:         serialized.RequestBody,
+		key:                 serialized.Key,
+		tags:                serialized.Tags,
+		responseBodyPlain:   serialized.ResponseBodyPlain,
+		responseBodyGzip:    serialized.ResponseBodyGzip,
+		responseBodyBrotli:  serialized.ResponseBodyBrotli,
+		responseBodyDeflate: serialized.ResponseBodyDeflate,
+		responseBodyZstd:    serialized.ResponseBodyZstd,
+		responseHeader:      serialized.ResponseHeader,
+		responseStatusCode:  serialized.ResponseStatusCode,
+	}
+	if serialized.ResponseModel != nil {
+		e.responseModel = serialized.ResponseModel
+		e.modelSize = uint64(len(serialized.ResponseModel))
+	}
+	return e, nil
+}
+
+func (s *serializedStore) Get(key string) (CacheEntry, bool, error) {
+	data, ok, err := s.backend.Get(s.prefix + key)
+	if err != nil || !ok {
+		return CacheEntry{}, false, err
+	}
+	entry, err := unmarshalEntry(data)
+	if err != nil {
+		return CacheEntry{}, false, err
+	}
+	return entry, true, nil
+}
+
+func (s *serializedStore) Set(key string, entry CacheEntry, ttl time.Duration) error {
+	data, err := marshalEntry(entry)
+	if err != nil {
+		return err
+	}
+	return s.backend.Set(s.prefix+key, data, ttl)
+}
+
+func (s *serializedStore) Delete(key string) error {
+	return s.backend.Delete(s.prefix + key)
+}
+
+func (s *serializedStore) Keys() ([]string, error) {
+	backendKeys, err := s.backend.Keys(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(backendKeys))
+	for _, key := range backendKeys {
+		keys = append(keys, strings.TrimPrefix(key, s.prefix))
+	}
+	return keys, nil
+}
+
+// Size of all serialized entries
+func (s *serializedStore) Size() (uint64, error) {
+	backendKeys, err := s.backend.Keys(s.prefix)
+	if err != nil {
+		return 0, err
+	}
+	total := uint64(0)
+	for _, key := range backendKeys {
+		data, ok, err := s.backend.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			total += uint64(len(data))
+		}
+	}
+	return total, nil
+}
+
+func (s *serializedStore) Count() (int, error) {
+	keys, err := s.backend.Keys(s.prefix)
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// NewMemoryBytesStore is an in-process BytesStore which expires values like redis or memcached would
+// it can be shared between multiple instances to simulate replicas (e.g. in tests)
+func NewMemoryBytesStore() BytesStore {
+	return &memoryBytesStore{
+		mu:   &sync.Mutex{},
+		data: map[string]memoryBytesValue{},
+	}
+}
+
+type memoryBytesStore struct {
+	mu   *sync.Mutex
+	data map[string]memoryBytesValue
+}
+
+type memoryBytesValue struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func (v memoryBytesValue) expired() bool {
+	return !v.expiresAt.IsZero() && time.Now().After(v.expiresAt)
+}
+
+func (s *memoryBytesStore) Get(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.data[key]
+	if !ok || value.expired() {
+		delete(s.data, key)
+		return nil, false, nil
+	}
+	copied := make([]byte, len(value.value))
+	copy(copied, value.value)
+	return copied, true, nil
+}
+
+func (s *memoryBytesStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := memoryBytesValue{value: make([]byte, len(value))}
+	copy(stored.value, value)
+	if ttl > 0 {
+		stored.expiresAt = time.Now().Add(ttl)
+	}
+	s.data[key] = stored
+	return nil
+}
+
+func (s *memoryBytesStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memoryBytesStore) Keys(prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []string{}
+	for key, value := range s.data {
+		if value.expired() {
+			delete(s.data, key)
+			continue
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,50 @@
+package uhttp
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// directives of the handler for the response which is currently being cached
+type cacheDirectives struct {
+	mu   *sync.Mutex
+	tags []string
+	ttl  time.Duration
+}
+
+// withCacheDirectives prepares the request, so the handler can give directives for caching its response
+func withCacheDirectives(handler Handler, r *http.Request) *http.Request {
+	directives := &cacheDirectives{mu: &sync.Mutex{}, tags: append([]string(nil), handler.opts.cacheTags...)}
+	return r.WithContext(context.WithValue(r.Context(), CtxKeyCacheDirectives, directives))
+}
+
+func getCacheDirectives(r *http.Request) (tags []string, ttl time.Duration) {
+	if directives, ok := r.Context().Value(CtxKeyCacheDirectives).(*cacheDirectives); ok {
+		directives.mu.Lock()
+		defer directives.mu.Unlock()
+		return append([]string(nil), directives.tags...), directives.ttl
+	}
+	return nil, 0
+}
+
+// AddCacheTags tags the cached response of the current request (for InvalidateTags)
+// it is ignored if the handler is not cached
+func AddCacheTags(r *http.Request, tags ...string) {
+	if directives, ok := r.Context().Value(CtxKeyCacheDirectives).(*cacheDirectives); ok {
+		directives.mu.Lock()
+		defer directives.mu.Unlock()
+		directives.tags = append(directives.tags, tags...)
+	}
+}
+
+// SetCacheTTL overrides the maxAge of WithCache for the response of the current request
+// (e.g. short for pending states and long for final ones). It is ignored if the handler is not cached
+func SetCacheTTL(r *http.Request, ttl time.Duration) {
+	if directives, ok := r.Context().Value(CtxKeyCacheDirectives).(*cacheDirectives); ok {
+		directives.mu.Lock()
+		defer directives.mu.Unlock()
+		directives.ttl = ttl
+	}
+}
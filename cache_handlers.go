@@ -3,6 +3,8 @@ package uhttp
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/dunv/uhttp/cache"
 )
 
 var cacheDetailsHandler = func(u *UHTTP, middlewares ...Middleware) Handler {
@@ -45,32 +47,21 @@ var cacheClearHandler = func(u *UHTTP, middlewares ...Middleware) Handler {
 		WithOptionalGet(R{
 			"path": STRING,
 			"hash": STRING,
+			"tag":  STRING,
 		}),
 		WithPost(func(r *http.Request, ret *int) interface{} {
-			deletedEntries := 0
-			path := GetAsString("path", r)
-			hash := GetAsString("hash", r)
-
-			u.cacheLock.RLock()
-			defer u.cacheLock.RUnlock()
-
-			for _, c := range u.cache {
-				if path != nil && *path != c.HandlerPattern() {
-					continue
-				}
-
-				keys := c.Keys()
-				for _, key := range keys {
-					if hash != nil && *hash != key {
-						continue
-					}
-
-					c.Delete(key)
-					deletedEntries++
-				}
+			invalidation := cache.Invalidation{}
+			if path := GetAsString("path", r); path != nil {
+				invalidation.Pattern = *path
+			}
+			if hash := GetAsString("hash", r); hash != nil {
+				invalidation.Key = *hash
+			}
+			if tag := GetAsString("tag", r); tag != nil {
+				invalidation.Tag = *tag
 			}
 			return map[string]int{
-				"deletedEntries": deletedEntries,
+				"deletedEntries": u.Cache().Invalidate(invalidation),
 			}
 		}),
 	)
@@ -83,21 +74,26 @@ var cacheSizeHandler = func(u *UHTTP, middlewares ...Middleware) Handler {
 			res := make(map[string]map[string]interface{})
 			totalSize := uint64(0)
 			totalEntries := uint64(0)
+			totalEvictions := uint64(0)
 			u.cacheLock.RLock()
 			for pattern, cache := range u.cache {
 				size := cache.Size()
 				totalSize += size
 				entries := uint64(cache.Count())
 				totalEntries += entries
+				evictions := cache.Evictions()
+				totalEvictions += evictions
 				res[pattern] = map[string]interface{}{
 					"sizeInBytes": size,
 					"entries":     entries,
+					"evictions":   evictions,
 				}
 			}
 			u.cacheLock.RUnlock()
 			res["total"] = map[string]interface{}{
 				"sizeInBytes": totalSize,
 				"entries":     totalEntries,
+				"evictions":   totalEvictions,
 			}
 			return res
 		}),
@@ -0,0 +1,65 @@
+package uhttp
+
+import (
+	"github.com/dunv/uhttp/cache"
+)
+
+// Programmatic access to the caches of all handlers (e.g. to invalidate entries after a mutation)
+type Caches struct {
+	u *UHTTP
+}
+
+func (u *UHTTP) Cache() *Caches {
+	return &Caches{u: u}
+}
+
+// InvalidateTags deletes all entries (of all handlers) which were tagged with at least one of the tags
+// see AddCacheTags and WithCacheTags
+func (c *Caches) InvalidateTags(tags ...string) int {
+	deleted := 0
+	for _, tag := range tags {
+		deleted += c.Invalidate(cache.Invalidation{Tag: tag})
+	}
+	return deleted
+}
+
+// InvalidatePattern deletes all entries of the handlers which match the pattern
+// (handlerPatterns or path.Match-patterns like "/users/*")
+func (c *Caches) InvalidatePattern(pattern string) int {
+	return c.Invalidate(cache.Invalidation{Pattern: pattern})
+}
+
+// Invalidate deletes all matching entries and publishes the invalidation to all other instances
+// (see WithCacheInvalidationBus). It returns how many entries were deleted in this instance
+func (c *Caches) Invalidate(invalidation cache.Invalidation) int {
+	deleted := c.invalidate(func(patternCache *cache.Cache) int {
+		return patternCache.Invalidate(invalidation)
+	})
+	if c.u.opts.cacheInvalidationBus != nil {
+		invalidation.Origin = c.u.instanceID
+		if err := c.u.opts.cacheInvalidationBus.Publish(invalidation); err != nil {
+			c.u.Log().Errorf("could not publish cache invalidation (%s)", err)
+		}
+	}
+	return deleted
+}
+
+// InvalidateWhere deletes all entries for which the predicate is true
+// it only applies to this instance (predicates cannot be published)
+func (c *Caches) InvalidateWhere(predicate func(handlerPattern string, entry cache.CacheEntry) bool) int {
+	return c.invalidate(func(patternCache *cache.Cache) int {
+		return patternCache.InvalidateWhere(func(_ string, entry cache.CacheEntry) bool {
+			return predicate(patternCache.HandlerPattern(), entry)
+		})
+	})
+}
+
+func (c *Caches) invalidate(invalidateCache func(patternCache *cache.Cache) int) int {
+	c.u.cacheLock.RLock()
+	defer c.u.cacheLock.RUnlock()
+	deleted := 0
+	for _, patternCache := range c.u.cache {
+		deleted += invalidateCache(patternCache)
+	}
+	return deleted
+}
@@ -0,0 +1,78 @@
+package uhttp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/dunv/uhttp/cache"
+)
+
+// SnapshotCaches writes the entries of all caches to the snapshot-directory (see WithCacheSnapshots)
+// it is called at the configured interval and by Shutdown, so no entries get lost on a graceful restart
+func (u *UHTTP) SnapshotCaches() error {
+	if u.opts.cacheSnapshotDir == "" {
+		return errors.New("cache snapshots are not configured")
+	}
+	if err := os.MkdirAll(u.opts.cacheSnapshotDir, 0755); err != nil {
+		return err
+	}
+
+	u.cacheLock.RLock()
+	defer u.cacheLock.RUnlock()
+	var errs []error
+	for pattern, patternCache := range u.cache {
+		if err := u.snapshotCache(pattern, patternCache); err != nil {
+			errs = append(errs, fmt.Errorf("could not snapshot cache of %s (%s)", pattern, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (u *UHTTP) snapshotCache(pattern string, c *cache.Cache) error {
+	// write to a temporary file first, so a crash cannot leave a truncated snapshot behind
+	file, err := os.CreateTemp(u.opts.cacheSnapshotDir, ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	written, err := c.WriteSnapshot(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), u.cacheSnapshotPath(pattern)); err != nil {
+		return err
+	}
+	u.Log().Infof("Snapshotted %d cache entries of %s", written, pattern)
+	return nil
+}
+
+// restoreCacheSnapshot warms a newly registered cache, a missing snapshot is not an error
+func (u *UHTTP) restoreCacheSnapshot(pattern string, c *cache.Cache) {
+	file, err := os.Open(u.cacheSnapshotPath(pattern))
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		u.Log().Errorf("could not open cache snapshot of %s (%s)", pattern, err)
+		return
+	}
+	defer file.Close()
+
+	restored, err := c.LoadSnapshot(file)
+	if err != nil {
+		u.Log().Errorf("could not restore cache snapshot of %s (%s)", pattern, err)
+	}
+	u.Log().Infof("Restored %d cache entries of %s", restored, pattern)
+}
+
+func (u *UHTTP) cacheSnapshotPath(pattern string) string {
+	return filepath.Join(u.opts.cacheSnapshotDir, url.PathEscape(pattern)+".snapshot")
+}
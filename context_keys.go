@@ -9,6 +9,14 @@ const (
 	CtxKeyIsAutomaticCacheExecution ContextKey = "uhttp.isAutomaticCacheExecution"
 	CtxKeyCache                     ContextKey = "uhttp.cache"
 	CtxKeyGetParams                 ContextKey = "uhttp.getParams"
+	CtxKeyParamsModel               ContextKey = "uhttp.paramsModel"
+	CtxKeyHeaderParams              ContextKey = "uhttp.headerParams"
+	CtxKeyCookieParams              ContextKey = "uhttp.cookieParams"
+	CtxKeyUploadedFiles             ContextKey = "uhttp.uploadedFiles"
+	CtxKeyPrincipal                 ContextKey = "uhttp.principal"
+	CtxKeyCacheDirectives           ContextKey = "uhttp.cacheDirectives"
+	CtxKeyHTTPCaching               ContextKey = "uhttp.httpCaching"
+	CtxKeyCompression               ContextKey = "uhttp.compression"
 	CtxKeyResponseWriter            ContextKey = "uhttp.responseWriter"
 	CtxKeyUHTTP                     ContextKey = "uhttp.uhttp"
 	CtxKeyTest                      ContextKey = "uhttp.test"
@@ -22,3 +30,12 @@ func IsAutomaticCacheExecution(r *http.Request) bool {
 	}
 	return false
 }
+
+// GetPrincipal returns the identity which was authenticated by a middleware (e.g. AuthBasic)
+// custom auth-middlewares can set CtxKeyPrincipal so it is used in cache-keys (see WithCacheKeyPrincipal)
+func GetPrincipal(r *http.Request) string {
+	if principal, ok := r.Context().Value(CtxKeyPrincipal).(string); ok {
+		return principal
+	}
+	return ""
+}
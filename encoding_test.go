@@ -1,16 +1,23 @@
 package uhttp_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/dunv/uhttp"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func setupEncodingTest(_ *testing.T, enableBrotli, enableGzip, enableDeflate bool) *uhttp.UHTTP {
-	opts := []uhttp.UhttpOption{}
+func setupEncodingTest(_ *testing.T, enableBrotli, enableGzip, enableDeflate bool, opts ...uhttp.UhttpOption) *uhttp.UHTTP {
 	if !enableBrotli {
 		opts = append(opts, uhttp.WithBrotliCompression(false, 5))
 	}
@@ -23,6 +30,7 @@ func setupEncodingTest(_ *testing.T, enableBrotli, enableGzip, enableDeflate boo
 
 	u := uhttp.NewUHTTP(opts...)
 	handler := uhttp.NewHandler(
+		uhttp.WithCompressionMinSize(0),
 		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
 			return map[string]string{"hello": "world"}
 		}),
@@ -97,3 +105,276 @@ func TestEncodingNoEncoding(t *testing.T) {
 	require.Equal(t, "", res.Header.Get("Content-Encoding"))
 	require.JSONEq(t, `{"hello": "world"}`, string(body))
 }
+
+func TestEncodingZstd(t *testing.T) {
+	u := setupEncodingTest(t, true, true, true, uhttp.WithZstdCompression(true, 3))
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Accept-Encoding", "br, gzip, deflate, zstd")
+	w := httptest.NewRecorder()
+	u.ServeMux().ServeHTTP(w, req)
+	res := w.Result()
+	body, err := uhttp.DecodeResponseBody(res)
+	require.NoError(t, err)
+	require.Equal(t, "zstd", res.Header.Get("Content-Encoding"))
+	require.JSONEq(t, `{"hello": "world"}`, string(body))
+}
+
+func TestEncodingZstdDisabledByDefault(t *testing.T) {
+	u := setupEncodingTest(t, true, true, true)
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Accept-Encoding", "zstd, gzip")
+	w := httptest.NewRecorder()
+	u.ServeMux().ServeHTTP(w, req)
+	res := w.Result()
+	body, err := uhttp.DecodeResponseBody(res)
+	require.NoError(t, err)
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	require.JSONEq(t, `{"hello": "world"}`, string(body))
+}
+
+func TestDecodingZstdRequest(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithPostModel(map[string]string{}, func(r *http.Request, model interface{}, ret *int) interface{} {
+			return model
+		}),
+	))
+
+	var compressed bytes.Buffer
+	zw, err := zstd.NewWriter(&compressed)
+	require.NoError(t, err)
+	_, err = zw.Write([]byte(`{"hello": "world"}`))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	req := httptest.NewRequest("POST", "/test", &compressed)
+	req.Header.Set("Content-Encoding", "zstd")
+	w := httptest.NewRecorder()
+	u.ServeMux().ServeHTTP(w, req)
+	res := w.Result()
+	body, err := uhttp.DecodeResponseBody(res)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"hello": "world"}`, string(body))
+}
+
+func TestEncodingNegotiation(t *testing.T) {
+	u := setupEncodingTest(t, true, true, true)
+	for acceptEncoding, expected := range map[string]string{
+		"br;q=0, gzip":                 "gzip",
+		"br;q=0.5, gzip;q=0.8":         "gzip",
+		"br;q=0.8, gzip;q=0.8":         "br",
+		"BR":                           "br",
+		"x-gzip":                       "gzip",
+		"brotli, gzipped":              "",
+		"*":                            "br",
+		"*;q=0.5, br;q=0":              "gzip",
+		"gzip;q=0.5, identity":         "",
+		"gzip, identity;q=0.5":         "gzip",
+		"":                             "",
+		"deflate;q=invalid, gzip;q=.5": "gzip",
+	} {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		u.ServeMux().ServeHTTP(w, req)
+		res := w.Result()
+		require.Equal(t, http.StatusOK, res.StatusCode, acceptEncoding)
+		require.Equal(t, expected, res.Header.Get("Content-Encoding"), acceptEncoding)
+		require.Equal(t, []string{"Accept-Encoding"}, res.Header.Values("Vary"), acceptEncoding)
+		body, err := uhttp.DecodeResponseBody(res)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"hello": "world"}`, string(body))
+	}
+}
+
+func TestEncodingPlainHasNoContentEncodingHeader(t *testing.T) {
+	u := setupEncodingTest(t, false, false, false)
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	u.ServeMux().ServeHTTP(w, req)
+	res := w.Result()
+	require.NotContains(t, res.Header, "Content-Encoding")
+	// the response does not depend on Accept-Encoding if nothing is enabled
+	require.NotContains(t, res.Header, "Vary")
+}
+
+func TestEncodingNotAcceptable(t *testing.T) {
+	for name, u := range map[string]*uhttp.UHTTP{
+		"compression":    setupEncodingTest(t, true, true, true),
+		"no compression": setupEncodingTest(t, false, false, false),
+	} {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Accept-Encoding", "compress, identity;q=0")
+		w := httptest.NewRecorder()
+		u.ServeMux().ServeHTTP(w, req)
+		res := w.Result()
+		require.Equal(t, http.StatusNotAcceptable, res.StatusCode, name)
+		require.Empty(t, res.Header.Get("Content-Encoding"), name)
+		body, err := uhttp.DecodeResponseBody(res)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"error": "no acceptable content-coding"}`, string(body), name)
+	}
+
+	// "*;q=0" excludes identity as well, unless listed explicitly
+	u := setupEncodingTest(t, true, true, true)
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Accept-Encoding", "*;q=0, gzip")
+	w := httptest.NewRecorder()
+	u.ServeMux().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+}
+
+func TestEncodingErrorResponse(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCompressionMinSize(0),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return errors.New("failed")
+		}),
+	))
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	u.ServeMux().ServeHTTP(w, req)
+	res := w.Result()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	body, err := uhttp.DecodeResponseBody(res)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"error": "failed"}`, string(body))
+}
+
+func largeEncodingModel() []map[string]string {
+	model := []map[string]string{}
+	for i := 0; i < 500; i++ {
+		model = append(model, map[string]string{"hello": "world", "index": strconv.Itoa(i)})
+	}
+	return model
+}
+
+func TestEncodingMinSize(t *testing.T) {
+	// responses smaller than 1 KiB are not compressed by default
+	u := uhttp.NewUHTTP()
+	u.Handle("/small", uhttp.NewHandler(uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+		return map[string]string{"hello": "world"}
+	})))
+	u.Handle("/large", uhttp.NewHandler(uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+		return largeEncodingModel()
+	})))
+	u.Handle("/override", uhttp.NewHandler(
+		uhttp.WithCompressionMinSize(0),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]string{"hello": "world"}
+		}),
+	))
+
+	for path, expected := range map[string]string{"/small": "", "/large": "br", "/override": "br"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", "br, gzip")
+		w := httptest.NewRecorder()
+		u.ServeMux().ServeHTTP(w, req)
+		res := w.Result()
+		require.Equal(t, expected, res.Header.Get("Content-Encoding"), path)
+		_, err := uhttp.DecodeResponseBody(res)
+		require.NoError(t, err)
+	}
+
+	// small bodies are still compressed if identity is not acceptable
+	req := httptest.NewRequest("GET", "/small", nil)
+	req.Header.Set("Accept-Encoding", "gzip, identity;q=0")
+	w := httptest.NewRecorder()
+	u.ServeMux().ServeHTTP(w, req)
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+}
+
+func TestEncodingHandlerLevels(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.Handle("/fast", uhttp.NewHandler(
+		uhttp.WithCompressionLevels(uhttp.CompressionLevels{Gzip: gzip.HuffmanOnly}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return largeEncodingModel()
+		}),
+	))
+	u.Handle("/default", uhttp.NewHandler(uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+		return largeEncodingModel()
+	})))
+
+	sizes := map[string]int{}
+	for _, encoding := range []string{"gzip", "br"} {
+		for _, path := range []string{"/fast", "/default"} {
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set("Accept-Encoding", encoding)
+			w := httptest.NewRecorder()
+			u.ServeMux().ServeHTTP(w, req)
+			require.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+			sizes[encoding+path] = w.Body.Len()
+			body, err := uhttp.DecodeResponseBody(w.Result())
+			require.NoError(t, err)
+			require.Contains(t, string(body), `"index":"499"`)
+		}
+	}
+	require.Greater(t, sizes["gzip/fast"], 3*sizes["gzip/default"])
+	// levels which are not set are taken from the defaults
+	require.Equal(t, sizes["br/default"], sizes["br/fast"])
+}
+
+func TestEncodingConcurrentPooledEncoders(t *testing.T) {
+	u := setupEncodingTest(t, true, true, true, uhttp.WithZstdCompression(true, 3))
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		for _, encoding := range []string{"br", "gzip", "deflate", "zstd"} {
+			wg.Add(1)
+			go func(encoding string) {
+				defer wg.Done()
+				req := httptest.NewRequest("GET", "/test", nil)
+				req.Header.Set("Accept-Encoding", encoding)
+				w := httptest.NewRecorder()
+				u.ServeMux().ServeHTTP(w, req)
+				res := w.Result()
+				assert.Equal(t, encoding, res.Header.Get("Content-Encoding"))
+				body, err := uhttp.DecodeResponseBody(res)
+				assert.NoError(t, err)
+				assert.JSONEq(t, `{"hello": "world"}`, string(body))
+			}(encoding)
+		}
+	}
+	wg.Wait()
+}
+
+// compares the former behavior (maximum levels for every response) with the defaults (with and without a threshold)
+func BenchmarkEncoding(b *testing.B) {
+	for name, opts := range map[string][]uhttp.UhttpOption{
+		"maxLevels": {uhttp.WithDynamicCompression(uhttp.CompressionLevels{Brotli: 11, Gzip: gzip.BestCompression, Deflate: gzip.BestCompression, Zstd: 22}, 0)},
+		"defaults":  {},
+		"noMinSize": {uhttp.WithDynamicCompression(uhttp.DefaultDynamicCompressionLevels(), 0)},
+	} {
+		for _, model := range []struct {
+			name  string
+			model interface{}
+		}{
+			{name: "small", model: map[string]string{"hello": "world"}},
+			{name: "large", model: largeEncodingModel()},
+		} {
+			for _, encoding := range []string{"br", "gzip"} {
+				u := uhttp.NewUHTTP(opts...)
+				response := model.model
+				u.Handle("/test", uhttp.NewHandler(
+					uhttp.WithDisableAccessLogging(),
+					uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+						return response
+					}),
+				))
+				b.Run(fmt.Sprintf("%s/%s/%s", name, model.name, encoding), func(b *testing.B) {
+					b.ReportAllocs()
+					for i := 0; i < b.N; i++ {
+						req := httptest.NewRequest("GET", "/test", nil)
+						req.Header.Set("Accept-Encoding", encoding)
+						u.ServeMux().ServeHTTP(httptest.NewRecorder(), req)
+					}
+				})
+			}
+		}
+	}
+}
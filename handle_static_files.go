@@ -4,229 +4,490 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/andybalholm/brotli"
 	"github.com/dunv/uhelpers"
-	"github.com/klauspost/compress/flate"
-	"github.com/klauspost/compress/gzip"
 )
 
 type cachedFile struct {
+	// relative to the root of the filesystem
+	Name           string
 	Content        []byte
 	GzippedContent []byte
 	BrContent      []byte
 	DeflateContent []byte
+	ZstdContent    []byte
 	ContentType    string
+	ContentHash    string
+	ModTime        time.Time
+	Size           int64
+	// files above the stream threshold are not loaded, they are read from the filesystem on every request
+	Streamed bool
+	// already compressed types are served uncompressed (if the client accepts identity)
+	Incompressible bool
+	// Cache-Control and custom headers (see WithStaticRules)
+	Header http.Header
 }
 
-var filesCache = map[string]cachedFile{}
+// encoded content, nil if it has not been compressed (yet)
+func (f *cachedFile) encoded(encoding string) []byte {
+	switch encoding {
+	case ENCODING_BROTLI:
+		return f.BrContent
+	case ENCODING_GZIP:
+		return f.GzippedContent
+	case ENCODING_DEFLATE:
+		return f.DeflateContent
+	case ENCODING_ZSTD:
+		return f.ZstdContent
+	}
+	return f.Content
+}
+
+// memory used by the content and its compressed copies
+func (f *cachedFile) memorySize() int64 {
+	return int64(len(f.Content) + len(f.GzippedContent) + len(f.BrContent) + len(f.DeflateContent) + len(f.ZstdContent))
+}
+
+// withEncoded returns a copy, served files are never modified (they are replaced)
+func (f cachedFile) withEncoded(encoding string, content []byte) *cachedFile {
+	switch encoding {
+	case ENCODING_BROTLI:
+		f.BrContent = content
+	case ENCODING_GZIP:
+		f.GzippedContent = content
+	case ENCODING_DEFLATE:
+		f.DeflateContent = content
+	case ENCODING_ZSTD:
+		f.ZstdContent = content
+	}
+	return &f
+}
+
+// precompressed siblings of static files, they are never served directly
+var precompressedSuffixes = map[string]string{
+	ENCODING_BROTLI:  ".brotli",
+	ENCODING_GZIP:    ".gz",
+	ENCODING_DEFLATE: ".deflate",
+	ENCODING_ZSTD:    ".zst",
+}
+
+// staticFiles is one tree of static files mounted below a prefix of a UHTTP instance
+type staticFiles struct {
+	prefix string
+	fsys   fs.FS
+	opts   *staticOptions
+
+	lock sync.RWMutex
+	// loaded files by name (in lazy mode only the recently used ones)
+	files map[string]*cachedFile
+	// size and modification time of all files by name
+	states map[string]staticFileState
+	// memory used by the loaded files
+	bytes int64
+	// lazy mode only (see WithStaticLazyLoading)
+	usage *staticUsage
+	// lazy loads and compressions which are in progress
+	flights staticFlightGroup
+
+	// dev mode only (see WithStaticDevMode)
+	reloadLock sync.Mutex
+	liveReload *liveReload
+}
 
 // static files handler which only works if initialized with "RegisterStaticFilesHandler"
-// (only serves from initialized cache)
+// (only serves the files mounted at "/")
 func StaticFilesHandler(u *UHTTP) http.HandlerFunc {
 	return chain(addLoggingMiddleware(u, nil, true))(func(w http.ResponseWriter, r *http.Request) {
-		if len(filesCache) == 0 {
+		u.staticLock.RLock()
+		static, ok := u.static["/"]
+		u.staticLock.RUnlock()
+		if !ok {
 			u.RenderError(w, r, errors.New("staticFilesHandler used but not initialized"))
 			return
 		}
+		static.serveHTTP(u, w, r)
+	})
+}
+
+func (s *staticFiles) handler(u *UHTTP) http.HandlerFunc {
+	return chain(addLoggingMiddleware(u, nil, true))(func(w http.ResponseWriter, r *http.Request) {
+		s.serveHTTP(u, w, r)
+	})
+}
+
+// lookup finds the file for a URL path, directories are answered with their index file
+// in lazy mode files are loaded on their first request
+func (s *staticFiles) lookup(u *UHTTP, urlPath string) (*cachedFile, bool, error) {
+	name := strings.TrimPrefix(urlPath, s.prefix)
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += s.opts.indexFile
+	}
 
-		var cachedFile cachedFile
-		var ok bool
+	s.lock.RLock()
+	file, loaded := s.files[name]
+	state, exists := s.states[name]
+	s.lock.RUnlock()
+
+	if loaded {
+		s.usage.touch(name)
+		return file, true, nil
+	}
+	if !exists || !s.opts.lazy {
+		return nil, false, nil
+	}
+	return s.loadLazily(u, name, state)
+}
+
+// put adds or replaces a loaded file (the lock must be held)
+// in lazy mode the least recently used files are evicted to stay within the memory budget
+func (s *staticFiles) put(name string, file *cachedFile) {
+	if existing, ok := s.files[name]; ok {
+		s.bytes -= existing.memorySize()
+	}
+	s.files[name] = file
+	s.bytes += file.memorySize()
 
-		// Find file (fallback to index.html)
-		if cachedFile, ok = filesCache[r.URL.Path]; !ok {
-			cachedFile = filesCache["/index.html"]
+	if !s.opts.lazy {
+		return
+	}
+	s.usage.touch(name)
+	for s.opts.memoryBudget > 0 && s.bytes > s.opts.memoryBudget {
+		victim, ok := s.usage.leastRecentlyUsed()
+		if !ok {
+			return
 		}
-		w.Header().Add("Content-Type", cachedFile.ContentType)
+		s.remove(victim)
+	}
+}
 
-		// If client accepts br or gzip -> return compressed
-		if acceptEncoding := r.Header.Get("Accept-Encoding"); strings.Contains(acceptEncoding, "br") && u.opts.enableBrotli {
-			w.Header().Add("Content-Encoding", "br")
-			if _, err := w.Write(cachedFile.BrContent); err != nil {
-				u.Log().Errorf("%s", err)
-			}
-		} else if acceptEncoding := r.Header.Get("Accept-Encoding"); strings.Contains(acceptEncoding, "gzip") && u.opts.enableGzip {
-			w.Header().Add("Content-Encoding", "gzip")
-			if _, err := w.Write(cachedFile.GzippedContent); err != nil {
-				u.Log().Errorf("%s", err)
-			}
-		} else if acceptEncoding := r.Header.Get("Accept-Encoding"); strings.Contains(acceptEncoding, "deflate") && u.opts.enableDeflate {
-			w.Header().Add("Content-Encoding", "deflate")
-			if _, err := w.Write(cachedFile.DeflateContent); err != nil {
-				u.Log().Errorf("%s", err)
+// remove a loaded file (the lock must be held)
+func (s *staticFiles) remove(name string) {
+	if existing, ok := s.files[name]; ok {
+		s.bytes -= existing.memorySize()
+		delete(s.files, name)
+	}
+	s.usage.forget(name)
+}
+
+func (s *staticFiles) serveHTTP(u *UHTTP, w http.ResponseWriter, r *http.Request) {
+	if s.liveReload != nil && r.URL.Path == s.prefix+STATIC_LIVE_RELOAD_PATH {
+		s.liveReload.serveHTTP(w, r)
+		return
+	}
+
+	cachedFile, ok, err := s.lookup(u, r.URL.Path)
+	if err != nil {
+		u.RenderErrorWithStatusCode(w, r, http.StatusInternalServerError, err, true)
+		return
+	}
+	if !ok {
+		switch s.opts.fallback {
+		case STATIC_FALLBACK_NOT_FOUND:
+			w.Header().Set("Content-Type", "application/json")
+			u.RenderErrorWithStatusCode(w, r, http.StatusNotFound, fmt.Errorf("%s not found", r.URL.Path), false)
+			return
+		case STATIC_FALLBACK_HANDLER:
+			s.opts.fallbackHandler.ServeHTTP(w, r)
+			return
+		default:
+			if cachedFile, ok, err = s.lookup(u, s.prefix); err != nil || !ok {
+				u.RenderErrorWithStatusCode(w, r, http.StatusNotFound, fmt.Errorf("%s not found", s.opts.indexFile), false)
+				return
 			}
+		}
+	}
+	w.Header().Add("Content-Type", cachedFile.ContentType)
+	for key, values := range cachedFile.Header {
+		w.Header()[key] = append([]string(nil), values...)
+	}
+	if cachedFile.Streamed {
+		s.serveStreamed(u, w, r, cachedFile)
+		return
+	}
+
+	encoding, acceptable := u.determineEncoding(r, http.StatusOK, len(cachedFile.Content))
+	if !acceptable {
+		u.writeNotAcceptable(w)
+		return
+	}
+
+	// ranges are only supported on the uncompressed content, already compressed types are not compressed again
+	if (cachedFile.Incompressible || r.Header.Get(HEADER_RANGE) != "") && encoding != ENCODING_PLAIN {
+		if identityAcceptable(r) {
+			encoding = ENCODING_PLAIN
 		} else {
-			if _, err := w.Write(cachedFile.Content); err != nil {
-				u.Log().Errorf("%s", err)
+			r = r.Clone(r.Context())
+			r.Header.Del(HEADER_RANGE)
+		}
+	}
+	u.setEncodingHeaders(w, encoding)
+
+	// the strong ETag is used for If-None-Match and If-Range
+	w.Header().Set(HEADER_ETAG, formatETag(cachedFile.ContentHash, ETAG_STRONG, encoding))
+
+	// If client accepts a coding -> return compressed
+	content := cachedFile.encoded(encoding)
+	if content == nil {
+		if content, err = s.compressLazily(u, cachedFile, encoding); err != nil {
+			u.RenderErrorWithStatusCode(w, r, http.StatusInternalServerError, err, true)
+			return
+		}
+	}
+	if encoding != ENCODING_PLAIN {
+		w.Header().Set(HEADER_CONTENT_LENGTH, strconv.Itoa(len(content)))
+	}
+
+	// takes care of conditional requests, (multipart-)ranges, Content-Length, Last-Modified and HEAD
+	// filesystems like embed.FS do not know modification times, Last-Modified is omitted for them
+	http.ServeContent(w, r, r.URL.Path, cachedFile.ModTime, bytes.NewReader(content))
+}
+
+// compressLazily compresses a file on its first request with an encoding (the result is kept)
+// concurrent requests for the same file and encoding wait for a single compression
+func (s *staticFiles) compressLazily(u *UHTTP, file *cachedFile, encoding string) ([]byte, error) {
+	result, err := s.flights.do(encoding+":"+file.ContentHash+":"+file.Name, func() (interface{}, error) {
+		// compressed by a flight which finished after the lookup
+		s.lock.RLock()
+		current, ok := s.files[file.Name]
+		s.lock.RUnlock()
+		if ok && current.ContentHash == file.ContentHash {
+			if content := current.encoded(encoding); content != nil {
+				return content, nil
 			}
 		}
+
+		var content []byte
+		var err error
+		if s.opts.devMode {
+			// files change often in dev mode, the dynamic levels are faster
+			content, err = compress(encoding, u.opts.dynamicCompressionLevels.level(encoding), file.Content)
+		} else {
+			content, err = u.compressStaticFile(s.fsys, file.Name, s.prefix+file.Name, encoding, file.Content)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		// the file might have been reloaded or evicted in the meantime
+		if current, ok := s.files[file.Name]; ok && current.ContentHash == file.ContentHash {
+			s.put(file.Name, current.withEncoded(encoding, content))
+		}
+		return content, nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]byte), nil
 }
 
 // RegisterStaticFilesHandler which serves content from a directory and
 // redirects all requests to non-existant files to index.html
 // index.html must be present!
 // - read all files from root directory
-// - create cache for these files containing original, gzip, br
+// - create cache for these files containing original, gzip, br, deflate, zstd
 // - register handlers for main http-mux
 func (u *UHTTP) RegisterStaticFilesHandler(root string) error {
-	fileNames := []string{}
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if path != root && !info.IsDir() && !strings.HasSuffix(path, ".brotli") && !strings.HasSuffix(path, ".gz") && !strings.HasSuffix(path, ".deflate") {
-			fileNames = append(fileNames, path)
-		}
-		return nil
-	})
+	return u.RegisterStaticFS("/", os.DirFS(root))
+}
+
+// RegisterStaticFS serves all files of fsys (e.g. embed.FS, os.DirFS or a zip.Reader) below prefix
+// requests to non-existent files below prefix are answered according to the fallback policy
+// (default: the index file, see WithStaticFallback) and precompressed siblings (.brotli, .gz, .deflate, .zst)
+// are used if present. Every prefix can only be registered once per instance.
+func (u *UHTTP) RegisterStaticFS(prefix string, fsys fs.FS, opts ...StaticOption) error {
+	mergedOpts := &staticOptions{}
+	for _, opt := range append([]StaticOption{withStaticDefaults()}, opts...) {
+		opt.apply(mergedOpts)
+	}
+
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix != "/" {
+		prefix += "/"
+	}
+
+	if mergedOpts.fallback == STATIC_FALLBACK_HANDLER && mergedOpts.fallbackHandler == nil {
+		return errors.New("static fallback handler is nil")
+	}
+	// without lazy loading all files are kept in memory (as before) unless the threshold is set explicitly
+	if mergedOpts.lazy && !mergedOpts.streamThresholdSet {
+		mergedOpts.streamThreshold = defaultStaticStreamThreshold
+	}
+
+	u.staticLock.Lock()
+	defer u.staticLock.Unlock()
+	if _, ok := u.static[prefix]; ok {
+		return fmt.Errorf("static files for %s already registered", prefix)
+	}
+
+	static := &staticFiles{prefix: prefix, fsys: fsys, opts: mergedOpts, files: map[string]*cachedFile{}}
+	if mergedOpts.lazy {
+		static.usage = newStaticUsage()
+	}
+	states, err := static.scan(u)
 	if err != nil {
 		return err
 	}
+	static.states = states
 
-	foundMainFile := false
-	for _, fileName := range fileNames {
-		if strings.Contains(fileName, ".DS_Store") {
-			u.Log().Infof("Skipping '%s'", fileName)
-			continue
+	// only the index-fallback needs the index file
+	if _, ok := states[mergedOpts.indexFile]; mergedOpts.fallback == STATIC_FALLBACK_INDEX && !ok {
+		return fmt.Errorf("could not find %s", mergedOpts.indexFile)
+	}
+
+	if mergedOpts.devMode && mergedOpts.liveReload {
+		static.liveReload = newLiveReload()
+	}
+
+	// files are only indexed in lazy mode
+	for fileName := range states {
+		if mergedOpts.lazy {
+			break
 		}
-		fileContent, err := os.ReadFile(fileName)
+		cached, err := static.load(u, fileName)
 		if err != nil {
 			return err
 		}
+		static.put(fileName, cached)
+		if !u.opts.silentStaticFileRegistration {
+			u.Log().Infof("Registered http static %s (%s, gzip:%s, br:%s, deflate:%s, zstd:%s)",
+				prefix+fileName,
+				uhelpers.FormatByteCountIEC(int64(len(cached.Content))),
+				uhelpers.FormatByteCountIEC(int64(len(cached.GzippedContent))),
+				uhelpers.FormatByteCountIEC(int64(len(cached.BrContent))),
+				uhelpers.FormatByteCountIEC(int64(len(cached.DeflateContent))),
+				uhelpers.FormatByteCountIEC(int64(len(cached.ZstdContent))),
+			)
+		}
+	}
 
-		// Strip the root part
-		var pattern string
-		if strings.HasPrefix(root, "./") {
-			pattern = strings.ReplaceAll(fileName, filepath.Base(root), "")
-		} else {
-			pattern = strings.ReplaceAll(fileName, root, "")
-		}
-
-		if strings.ReplaceAll(pattern, "/", "") == "index.html" {
-			foundMainFile = true
-		}
-
-		// fmt.Println("registering", fileName, pattern, strings.ReplaceAll(pattern, "/", ""))
-
-		// Detect content-type automatically
-		contentType := http.DetectContentType(fileContent)
-
-		// Cannot identify the following from the file itself
-		// Overrides (taken from)
-		// https://wiki.selfhtml.org/wiki/MIME-Type/%C3%9Cbersicht
-		if strings.HasSuffix(pattern, ".js") {
-			contentType = "text/javascript; charset=utf-8"
-		} else if strings.HasSuffix(pattern, ".css") {
-			contentType = "text/css; charset=utf-8"
-		} else if strings.HasSuffix(pattern, ".html") {
-			contentType = "text/html; charset=utf-8"
-		} else if strings.HasSuffix(pattern, ".svg") {
-			contentType = "image/svg+xml; charset=utf-8"
-		}
-
-		cached := cachedFile{
-			Content:     fileContent,
-			ContentType: contentType,
-		}
-
-		if u.opts.enableGzip {
-			if _, err := os.Stat(fmt.Sprintf("%s.gz", fileName)); err == nil {
-				u.Log().Infof("http static: gzip-compressed file %s exists, not compressing again", pattern)
-				cached.GzippedContent, err = os.ReadFile(fmt.Sprintf("%s.gz", fileName))
-				if err != nil {
-					return err
-				}
-			} else {
-				var buffer bytes.Buffer
-				u.Log().Infof("http static: gzip-compressed file %s does not exist. Compressing", pattern)
-				gzipWriter, err := gzip.NewWriterLevel(&buffer, u.opts.gzipCompressionLevel)
-				if err != nil {
-					return err
-				}
-				if _, err = gzipWriter.Write(fileContent); err != nil {
-					return err
-				}
-				if err := gzipWriter.Flush(); err != nil {
-					return err
-				}
-				if err := gzipWriter.Close(); err != nil {
-					return err
-				}
-				cached.GzippedContent = buffer.Bytes()
-			}
+	if mergedOpts.devMode {
+		if err := static.watch(u); err != nil {
+			return err
 		}
+	}
 
-		if u.opts.enableBrotli {
-			if _, err := os.Stat(fmt.Sprintf("%s.brotli", fileName)); err == nil {
-				u.Log().Infof("http static: brotli-compressed file %s exists, not compressing again", pattern)
-				cached.BrContent, err = os.ReadFile(fmt.Sprintf("%s.brotli", fileName))
-				if err != nil {
-					return err
-				}
-			} else {
-				var buffer bytes.Buffer
-				u.Log().Infof("http static: brotli-compressed file %s does not exist. Compressing", pattern)
-				brotliWriter := brotli.NewWriterLevel(&buffer, u.opts.brotliCompressionLevel)
-				if _, err = brotliWriter.Write(fileContent); err != nil {
-					return err
-				}
-				if err := brotliWriter.Flush(); err != nil {
-					return err
-				}
-				if err := brotliWriter.Close(); err != nil {
-					return err
-				}
-				cached.BrContent = buffer.Bytes()
-			}
+	// a single subtree-pattern serves all files (and the fallback)
+	u.static[prefix] = static
+	u.Log().Infof("Registered http static %s (%d files, %s in memory, fallback: %s)",
+		prefix, len(states), uhelpers.FormatByteCountIEC(static.bytes), mergedOpts.fallback)
+	u.opts.serveMux.HandleFunc(prefix, static.handler(u))
+
+	return nil
+}
+
+// scan lists all servable files (by name) of the filesystem
+func (s *staticFiles) scan(u *UHTTP) (map[string]staticFileState, error) {
+	states := map[string]staticFileState{}
+	err := fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || isPrecompressedSibling(s.fsys, name) {
+			return nil
 		}
+		if strings.Contains(name, ".DS_Store") {
+			u.Log().Infof("Skipping '%s'", name)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		states[name] = staticFileState{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return states, err
+}
 
-		if u.opts.enableDeflate {
-			if _, err := os.Stat(fmt.Sprintf("%s.deflate", fileName)); err == nil {
-				u.Log().Infof("http static: deflate-compressed file %s exists, not compressing again", pattern)
-				cached.DeflateContent, err = os.ReadFile(fmt.Sprintf("%s.deflate", fileName))
-				if err != nil {
-					return err
-				}
-			} else {
-				var buffer bytes.Buffer
-				u.Log().Infof("http static: deflate-compressed file %s does not exist. Compressing", pattern)
-				deflateWriter, err := flate.NewWriter(&buffer, u.opts.deflateCompressionLevel)
-				if err != nil {
-					return err
-				}
-				if _, err = deflateWriter.Write(fileContent); err != nil {
-					return err
-				}
-				if err := deflateWriter.Flush(); err != nil {
-					return err
-				}
-				if err := deflateWriter.Close(); err != nil {
-					return err
-				}
-				cached.DeflateContent = buffer.Bytes()
-			}
+// load reads a file, in dev and lazy mode it is compressed lazily (on its first request with an encoding)
+func (s *staticFiles) load(u *UHTTP, fileName string) (*cachedFile, error) {
+	fileInfo, err := fs.Stat(s.fsys, fileName)
+	if err != nil {
+		return nil, err
+	}
+	if s.opts.streamThreshold > 0 && fileInfo.Size() > s.opts.streamThreshold {
+		return s.loadStreamed(fileName, fileInfo)
+	}
+	fileContent, err := fs.ReadFile(s.fsys, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	// fs.FS names are always relative to the root, nothing needs to be stripped
+	pattern := s.prefix + fileName
+	contentType := s.contentType(fileName, fileContent)
+
+	if s.liveReload != nil && strings.HasPrefix(contentType, "text/html") {
+		fileContent = injectLiveReloadScript(fileContent, s.prefix+STATIC_LIVE_RELOAD_PATH)
+	}
+
+	cached := &cachedFile{
+		Name:        fileName,
+		Content:     fileContent,
+		ContentType: contentType,
+		ContentHash: contentHash(fileContent),
+		ModTime:     fileInfo.ModTime(),
+		Size:        int64(len(fileContent)),
+		// images, videos, archives, ...
+		Incompressible: isIncompressible(contentType),
+		Header:         staticHeaders(fileName, s.opts.rules, s.opts.fingerprintCacheControl),
+	}
+
+	// precompressed siblings are not used in dev mode, they are most likely outdated
+	if s.opts.devMode || s.opts.lazy || cached.Incompressible {
+		return cached, nil
+	}
+	for _, encoding := range u.enabledEncodings() {
+		compressed, err := u.compressStaticFile(s.fsys, fileName, pattern, encoding, fileContent)
+		if err != nil {
+			return nil, err
 		}
+		cached = cached.withEncoded(encoding, compressed)
+	}
+	return cached, nil
+}
 
-		filesCache[pattern] = cached
-		if !u.opts.silentStaticFileRegistration {
-			u.Log().Infof("Registered http static %s (%s, gzip:%s, br:%s, deflate:%s)",
-				pattern,
-				uhelpers.FormatByteCountIEC(int64(len(fileContent))),
-				uhelpers.FormatByteCountIEC(int64(len(cached.GzippedContent))),
-				uhelpers.FormatByteCountIEC(int64(len(cached.BrContent))),
-				uhelpers.FormatByteCountIEC(int64(len(cached.DeflateContent))),
-			)
+// isPrecompressedSibling is true for compressed variants of another file (app.js.gz next to app.js)
+// compressed files without their base file (backup.tar.gz) are served as they are
+func isPrecompressedSibling(fsys fs.FS, name string) bool {
+	for _, suffix := range precompressedSuffixes {
+		if base := strings.TrimSuffix(name, suffix); base != name {
+			if info, err := fs.Stat(fsys, base); err == nil && !info.IsDir() {
+				return true
+			}
 		}
-		u.opts.serveMux.HandleFunc(pattern, StaticFilesHandler(u))
 	}
-	u.Log().Infof("Registered http static / -> /index.html")
-	u.opts.serveMux.HandleFunc("/", StaticFilesHandler(u))
+	return false
+}
 
-	if !foundMainFile {
-		return errors.New("could not find index.html")
+// compressStaticFile uses the precompressed sibling of a file (if present) or compresses it with the static level
+func (u *UHTTP) compressStaticFile(fsys fs.FS, fileName string, pattern string, encoding string, fileContent []byte) ([]byte, error) {
+	if precompressed, err := fs.ReadFile(fsys, fileName+precompressedSuffixes[encoding]); err == nil {
+		u.Log().Infof("http static: %s-compressed file %s exists, not compressing again", encoding, pattern)
+		return precompressed, nil
 	}
 
-	return nil
+	u.Log().Infof("http static: %s-compressed file %s does not exist. Compressing", encoding, pattern)
+	return compress(encoding, u.opts.staticCompressionLevels().level(encoding), fileContent)
+}
+
+func compress(encoding string, level int, content []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := getEncoder(&buffer, encoding, level)
+	if _, err := encoder.Write(content); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
 }
@@ -0,0 +1,181 @@
+package uhttp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// served below the prefix of static files with live reload enabled
+const STATIC_LIVE_RELOAD_PATH = "__uhttp/livereload"
+
+// StaticWatcher notifies about changes of static files (see WithStaticWatcher)
+// Watch is called once on registration and must not block, the filesystem is rescanned on every call of changed
+type StaticWatcher interface {
+	Watch(changed func()) error
+}
+
+// what is compared to detect changes
+type staticFileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// watch starts polling (or the custom watcher) for changes
+func (s *staticFiles) watch(u *UHTTP) error {
+	if s.opts.watcher != nil {
+		return s.opts.watcher.Watch(func() { s.reload(u) })
+	}
+	if s.opts.pollInterval <= 0 {
+		return errors.New("static dev mode needs a poll interval > 0")
+	}
+
+	go func() {
+		for {
+			time.Sleep(s.opts.pollInterval)
+			s.reload(u)
+		}
+	}()
+	return nil
+}
+
+// reload rescans the filesystem and replaces all changed, added and removed files
+func (s *staticFiles) reload(u *UHTTP) {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+
+	states, err := s.scan(u)
+	if err != nil {
+		u.Log().Errorf("http static: could not scan %s (%s)", s.prefix, err)
+		return
+	}
+
+	changed := map[string]*cachedFile{}
+	for name, state := range states {
+		if previous, ok := s.states[name]; ok && previous == state {
+			continue
+		}
+		// lazy mode: the file is loaded again on its next request
+		if s.opts.lazy {
+			changed[name] = nil
+			continue
+		}
+		file, err := s.load(u, name)
+		if err != nil {
+			// probably still being written, the previous version is kept and the zero state forces a retry with the next scan
+			u.Log().Errorf("http static: could not reload %s%s (%s)", s.prefix, name, err)
+			states[name] = staticFileState{}
+			continue
+		}
+		changed[name] = file
+	}
+	removed := []string{}
+	for name := range s.states {
+		if _, ok := states[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	s.lock.Lock()
+	s.states = states
+	for name, file := range changed {
+		if file == nil {
+			s.remove(name)
+		} else {
+			s.put(name, file)
+		}
+	}
+	for _, name := range removed {
+		s.remove(name)
+	}
+	s.lock.Unlock()
+
+	if len(changed) == 0 && len(removed) == 0 {
+		return
+	}
+
+	u.Log().Infof("http static: reloaded %s (%d changed, %d removed)", s.prefix, len(changed), len(removed))
+	if s.liveReload != nil {
+		s.liveReload.notify()
+	}
+}
+
+// liveReload informs all connected browsers about changes via server-sent events
+type liveReload struct {
+	lock    sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+func newLiveReload() *liveReload {
+	return &liveReload{clients: map[chan struct{}]struct{}{}}
+}
+
+func (l *liveReload) subscribe() chan struct{} {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	// buffered: a notification is never lost while the client is busy writing
+	client := make(chan struct{}, 1)
+	l.clients[client] = struct{}{}
+	return client
+}
+
+func (l *liveReload) unsubscribe(client chan struct{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.clients, client)
+}
+
+func (l *liveReload) notify() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for client := range l.clients {
+		select {
+		case client <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (l *liveReload) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client := l.subscribe()
+	defer l.unsubscribe(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set(HEADER_CACHE_CONTROL, "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client:
+			if _, err := fmt.Fprint(w, "data: reload\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// injectLiveReloadScript before </body> (or at the end if there is none)
+func injectLiveReloadScript(content []byte, url string) []byte {
+	script := []byte(fmt.Sprintf(`<script>new EventSource("%s").onmessage=function(){location.reload()}</script>`, url))
+	index := bytes.LastIndex(bytes.ToLower(content), []byte("</body>"))
+	if index == -1 {
+		return append(append([]byte{}, content...), script...)
+	}
+	injected := make([]byte, 0, len(content)+len(script))
+	injected = append(injected, content[:index]...)
+	injected = append(injected, script...)
+	return append(injected, content[index:]...)
+}
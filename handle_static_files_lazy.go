@@ -0,0 +1,200 @@
+package uhttp
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// staticUsage orders the loaded files in lazy mode by their last access (most recent first),
+// all methods are no-ops on nil
+type staticUsage struct {
+	lock    sync.Mutex
+	recency *list.List
+	entries map[string]*list.Element
+}
+
+func newStaticUsage() *staticUsage {
+	return &staticUsage{recency: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (t *staticUsage) touch(name string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if element, ok := t.entries[name]; ok {
+		t.recency.MoveToFront(element)
+		return
+	}
+	t.entries[name] = t.recency.PushFront(name)
+}
+
+func (t *staticUsage) forget(name string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if element, ok := t.entries[name]; ok {
+		t.recency.Remove(element)
+		delete(t.entries, name)
+	}
+}
+
+func (t *staticUsage) leastRecentlyUsed() (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if element := t.recency.Back(); element != nil {
+		return element.Value.(string), true
+	}
+	return "", false
+}
+
+// staticFlightGroup lets concurrent requests for the same file wait for a single load or compression
+type staticFlightGroup struct {
+	lock    sync.Mutex
+	flights map[string]*staticFlight
+}
+
+type staticFlight struct {
+	done   chan struct{}
+	result interface{}
+	err    error
+}
+
+// do runs load once for all callers which arrive while it is running
+func (g *staticFlightGroup) do(key string, load func() (interface{}, error)) (interface{}, error) {
+	g.lock.Lock()
+	if flight, ok := g.flights[key]; ok {
+		g.lock.Unlock()
+		<-flight.done
+		return flight.result, flight.err
+	}
+	if g.flights == nil {
+		g.flights = map[string]*staticFlight{}
+	}
+	flight := &staticFlight{done: make(chan struct{})}
+	g.flights[key] = flight
+	g.lock.Unlock()
+
+	defer func() {
+		g.lock.Lock()
+		delete(g.flights, key)
+		g.lock.Unlock()
+		close(flight.done)
+	}()
+	flight.result, flight.err = load()
+	return flight.result, flight.err
+}
+
+// loadLazily loads an indexed file on its first request and keeps it (within the memory budget)
+func (s *staticFiles) loadLazily(u *UHTTP, name string, state staticFileState) (*cachedFile, bool, error) {
+	result, err := s.flights.do("load:"+name, func() (interface{}, error) {
+		// loaded by a flight which finished after the lookup
+		s.lock.RLock()
+		file, loaded := s.files[name]
+		s.lock.RUnlock()
+		if loaded {
+			return file, nil
+		}
+
+		file, err := s.load(u, name)
+		if err != nil {
+			return nil, err
+		}
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		// the file might have been changed or loaded by another request in the meantime
+		if current, ok := s.states[name]; ok && current == state {
+			if _, loaded := s.files[name]; !loaded {
+				s.put(name, file)
+			}
+		}
+		return file, nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		// removed since it was indexed
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return result.(*cachedFile), true, nil
+}
+
+// loadStreamed only reads the beginning of a file (to detect its content-type)
+func (s *staticFiles) loadStreamed(fileName string, fileInfo fs.FileInfo) (*cachedFile, error) {
+	file, err := s.fsys.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// http.DetectContentType considers at most 512 bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	return &cachedFile{
+		Name:        fileName,
+		ContentType: s.contentType(fileName, head[:n]),
+		// hashing the content would mean reading the whole file
+		ContentHash: fmt.Sprintf("%x-%x", fileInfo.ModTime().UnixNano(), fileInfo.Size()),
+		ModTime:     fileInfo.ModTime(),
+		Size:        fileInfo.Size(),
+		Streamed:    true,
+		Header:      staticHeaders(fileName, s.opts.rules, s.opts.fingerprintCacheControl),
+	}, nil
+}
+
+// serveStreamed copies a file from the filesystem, it is never compressed
+func (s *staticFiles) serveStreamed(u *UHTTP, w http.ResponseWriter, r *http.Request, cachedFile *cachedFile) {
+	if !identityAcceptable(r) {
+		u.writeNotAcceptable(w)
+		return
+	}
+	u.setEncodingHeaders(w, ENCODING_PLAIN)
+	etag := formatETag(cachedFile.ContentHash, ETAG_STRONG, ENCODING_PLAIN)
+	w.Header().Set(HEADER_ETAG, etag)
+
+	file, err := s.fsys.Open(cachedFile.Name)
+	if err != nil {
+		u.RenderErrorWithStatusCode(w, r, http.StatusInternalServerError, err, true)
+		return
+	}
+	defer file.Close()
+
+	// files of e.g. os.DirFS can seek, so ranges are supported
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, r.URL.Path, cachedFile.ModTime, seeker)
+		return
+	}
+
+	if notModified(r, etag, cachedFile.ModTime) {
+		writeNotModified(w)
+		return
+	}
+	if !cachedFile.ModTime.IsZero() {
+		w.Header().Set(HEADER_LAST_MODIFIED, cachedFile.ModTime.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set(HEADER_CONTENT_LENGTH, strconv.FormatInt(cachedFile.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		u.Log().Errorf("http static: could not stream %s (%s)", r.URL.Path, err)
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"testing"
 
 	"github.com/dunv/uhttp"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
 )
 
 func setupSinglePage(t *testing.T) *uhttp.UHTTP {
@@ -184,3 +186,100 @@ func TestSinglePageAppHandlerReturnActualFileDeflate(t *testing.T) {
 	}
 
 }
+
+func TestSinglePageAppHandlerConditional(t *testing.T) {
+	u := setupSinglePage(t)
+
+	request := func(header map[string]string) *http.Response {
+		req := httptest.NewRequest("GET", "http://example.com/main.css", nil)
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		uhttp.StaticFilesHandler(u)(w, req)
+		return w.Result()
+	}
+
+	res := request(nil)
+	etag := res.Header.Get(uhttp.HEADER_ETAG)
+	lastModified := res.Header.Get(uhttp.HEADER_LAST_MODIFIED)
+	if etag == "" || lastModified == "" {
+		t.Errorf("expected validators (etag: '%s', lastModified: '%s')", etag, lastModified)
+		return
+	}
+
+	if res := request(map[string]string{uhttp.HEADER_IF_NONE_MATCH: etag}); res.StatusCode != http.StatusNotModified {
+		t.Errorf("did not return http %d (actual: %d)", http.StatusNotModified, res.StatusCode)
+	}
+	if res := request(map[string]string{uhttp.HEADER_IF_MODIFIED_SINCE: lastModified}); res.StatusCode != http.StatusNotModified {
+		t.Errorf("did not return http %d (actual: %d)", http.StatusNotModified, res.StatusCode)
+	}
+
+	// compressed representations have their own etag
+	res = request(map[string]string{uhttp.HEADER_IF_NONE_MATCH: etag, "Accept-Encoding": "gzip"})
+	if res.StatusCode != http.StatusOK || res.Header.Get(uhttp.HEADER_ETAG) == etag {
+		t.Errorf("expected a new representation (statusCode: %d, etag: '%s')", res.StatusCode, res.Header.Get(uhttp.HEADER_ETAG))
+	}
+}
+
+func TestSinglePageAppHandlerReturnActualFileZstd(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "index.html"), []byte("<html></html>"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "main.css"), []byte(".test{ font-weight:bold;}"), 0644))
+
+	// precompressed files are served as they are
+	var precompressed bytes.Buffer
+	zw, err := zstd.NewWriter(&precompressed)
+	require.NoError(t, err)
+	_, err = zw.Write([]byte(".precompressed{}"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "main.css.zst"), precompressed.Bytes(), 0644))
+
+	u := uhttp.NewUHTTP(uhttp.WithZstdCompression(true, 3))
+	require.NoError(t, u.RegisterStaticFilesHandler(tempDir))
+
+	for path, expected := range map[string]string{
+		"/main.css":   ".precompressed{}",
+		"/index.html": "<html></html>",
+	} {
+		req := httptest.NewRequest("GET", "http://example.com"+path, nil)
+		req.Header.Add("Accept-Encoding", "gzip, zstd")
+		w := httptest.NewRecorder()
+		uhttp.StaticFilesHandler(u)(w, req)
+		res := w.Result()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "zstd", res.Header.Get("Content-Encoding"))
+		responseDecoded, err := uhttp.DecodeResponseBody(res)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(responseDecoded))
+	}
+
+	// the precompressed file itself is not registered
+	req := httptest.NewRequest("GET", "http://example.com/main.css.zst", nil)
+	w := httptest.NewRecorder()
+	uhttp.StaticFilesHandler(u)(w, req)
+	require.Equal(t, "<html></html>", w.Body.String())
+}
+
+func TestSinglePageAppHandlerNegotiation(t *testing.T) {
+	u := setupSinglePage(t)
+
+	req := httptest.NewRequest("GET", "http://example.com/main.css", nil)
+	req.Header.Add("Accept-Encoding", "br;q=0, gzip;q=0.5")
+	w := httptest.NewRecorder()
+	uhttp.StaticFilesHandler(u)(w, req)
+	res := w.Result()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	require.Equal(t, "Accept-Encoding", res.Header.Get("Vary"))
+	responseDecoded, err := uhttp.DecodeResponseBody(res)
+	require.NoError(t, err)
+	require.Equal(t, ".test{ font-weight:bold;}", string(responseDecoded))
+
+	req = httptest.NewRequest("GET", "http://example.com/main.css", nil)
+	req.Header.Add("Accept-Encoding", "identity;q=0")
+	w = httptest.NewRecorder()
+	uhttp.StaticFilesHandler(u)(w, req)
+	require.Equal(t, http.StatusNotAcceptable, w.Code)
+}
@@ -0,0 +1,111 @@
+package uhttp_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dunv/uhttp"
+	"github.com/stretchr/testify/require"
+)
+
+// writeStaticFile with an explicit modification time (filesystems might not be precise enough to detect a change)
+func writeStaticFile(t *testing.T, dir string, name string, content string, modTime time.Time) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, name), modTime, modTime))
+}
+
+func TestStaticFSDevModeReload(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Hour)
+	writeStaticFile(t, dir, "index.html", "<html>v1</html>", modTime)
+	writeStaticFile(t, dir, "app.js", "v1", modTime)
+	// ignored in dev mode
+	writeStaticFile(t, dir, "app.js.gz", "outdated", modTime)
+
+	u := uhttp.NewUHTTP(uhttp.WithGzipCompression(true, 5))
+	require.NoError(t, u.RegisterStaticFS("/", os.DirFS(dir), uhttp.WithStaticDevMode(10*time.Millisecond)))
+
+	// compressed lazily
+	res, body := staticFSGet(t, u, "/app.js", "gzip")
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	require.Equal(t, "v1", body)
+
+	writeStaticFile(t, dir, "app.js", "v2", modTime.Add(time.Minute))
+	writeStaticFile(t, dir, "new.js", "new", modTime)
+	require.NoError(t, os.Remove(filepath.Join(dir, "index.html")))
+
+	require.Eventually(t, func() bool {
+		_, body := staticFSGet(t, u, "/app.js", "gzip")
+		return body == "v2"
+	}, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		res, body := staticFSGet(t, u, "/new.js", "")
+		return res.StatusCode == http.StatusOK && body == "new"
+	}, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		res, _ := staticFSGet(t, u, "/index.html", "")
+		return res.StatusCode == http.StatusNotFound
+	}, time.Second, 10*time.Millisecond)
+}
+
+type manualStaticWatcher struct {
+	changed func()
+}
+
+func (w *manualStaticWatcher) Watch(changed func()) error {
+	w.changed = changed
+	return nil
+}
+
+func TestStaticFSDevModeWatcher(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Hour)
+	writeStaticFile(t, dir, "index.html", "<html>v1</html>", modTime)
+
+	watcher := &manualStaticWatcher{}
+	u := uhttp.NewUHTTP()
+	require.NoError(t, u.RegisterStaticFS("/", os.DirFS(dir), uhttp.WithStaticWatcher(watcher)))
+	require.NotNil(t, watcher.changed)
+
+	writeStaticFile(t, dir, "index.html", "<html>v2</html>", modTime.Add(time.Minute))
+	_, body := staticFSGet(t, u, "/", "")
+	require.Equal(t, "<html>v1</html>", body)
+
+	watcher.changed()
+	_, body = staticFSGet(t, u, "/", "")
+	require.Equal(t, "<html>v2</html>", body)
+}
+
+func TestStaticFSDevModeLiveReload(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Hour)
+	writeStaticFile(t, dir, "index.html", "<html><body>v1</body></html>", modTime)
+
+	watcher := &manualStaticWatcher{}
+	u := uhttp.NewUHTTP()
+	require.NoError(t, u.RegisterStaticFS("/app", os.DirFS(dir), uhttp.WithStaticWatcher(watcher), uhttp.WithStaticLiveReload()))
+
+	_, body := staticFSGet(t, u, "/app/", "")
+	require.Equal(t, `<html><body>v1<script>new EventSource("/app/__uhttp/livereload").onmessage=function(){location.reload()}</script></body></html>`, body)
+
+	server := httptest.NewServer(u.ServeMux())
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/app/" + uhttp.STATIC_LIVE_RELOAD_PATH)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	writeStaticFile(t, dir, "index.html", "<html><body>v2</body></html>", modTime.Add(time.Minute))
+	watcher.changed()
+
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "data: reload\n", line)
+}
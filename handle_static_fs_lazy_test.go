@@ -0,0 +1,217 @@
+package uhttp_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/dunv/uhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticFSLazyLoading(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Hour)
+	writeStaticFile(t, dir, "index.html", strings.Repeat("i", 100), modTime)
+	writeStaticFile(t, dir, "a.txt", strings.Repeat("a", 100), modTime)
+	writeStaticFile(t, dir, "b.txt", strings.Repeat("b", 100), modTime)
+
+	u := uhttp.NewUHTTP(uhttp.WithGzipCompression(true, 5))
+	require.NoError(t, u.RegisterStaticFS("/", os.DirFS(dir), uhttp.WithStaticLazyLoading(250)))
+
+	// only indexed on registration
+	writeStaticFile(t, dir, "a.txt", strings.Repeat("A", 100), modTime)
+	_, body := staticFSGet(t, u, "/a.txt", "")
+	require.Equal(t, strings.Repeat("A", 100), body)
+
+	// compressed on the first request with an encoding
+	res, body := staticFSGet(t, u, "/a.txt", "gzip")
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	require.Equal(t, strings.Repeat("A", 100), body)
+
+	// kept in memory
+	writeStaticFile(t, dir, "a.txt", strings.Repeat("x", 100), modTime)
+	_, body = staticFSGet(t, u, "/a.txt", "")
+	require.Equal(t, strings.Repeat("A", 100), body)
+
+	// loading the other files exceeds the budget, the least recently used file is evicted
+	_, body = staticFSGet(t, u, "/b.txt", "")
+	require.Equal(t, strings.Repeat("b", 100), body)
+	_, body = staticFSGet(t, u, "/", "")
+	require.Equal(t, strings.Repeat("i", 100), body)
+	_, body = staticFSGet(t, u, "/a.txt", "")
+	require.Equal(t, strings.Repeat("x", 100), body)
+
+	// unknown files are not loaded
+	res, _ = staticFSGet(t, u, "/c.txt", "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "text/html; charset=utf-8", res.Header.Get("Content-Type"))
+}
+
+// countingFS counts how often a file is opened (stat and read both open it)
+type countingFS struct {
+	fs.FS
+	lock  sync.Mutex
+	opens map[string]int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.lock.Lock()
+	c.opens[name]++
+	c.lock.Unlock()
+	// gives concurrent requests time to arrive while the file is loaded
+	time.Sleep(10 * time.Millisecond)
+	return c.FS.Open(name)
+}
+
+func (c *countingFS) count(name string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.opens[name]
+}
+
+func TestStaticFSLazyLoadingConcurrent(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html": {Data: []byte("<html></html>")},
+		"app.js":     {Data: []byte(strings.Repeat("console.log('app');", 100))},
+	}
+
+	// a single request as a reference
+	single := &countingFS{FS: files, opens: map[string]int{}}
+	u := uhttp.NewUHTTP(uhttp.WithGzipCompression(true, 5))
+	require.NoError(t, u.RegisterStaticFS("/", single, uhttp.WithStaticLazyLoading(0)))
+	staticFSGet(t, u, "/app.js", "gzip")
+
+	concurrent := &countingFS{FS: files, opens: map[string]int{}}
+	u = uhttp.NewUHTTP(uhttp.WithGzipCompression(true, 5))
+	require.NoError(t, u.RegisterStaticFS("/", concurrent, uhttp.WithStaticLazyLoading(0)))
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			u.ServeMux().ServeHTTP(w, req)
+			body, err := uhttp.DecodeResponseBody(w.Result())
+			assert.NoError(t, err)
+			assert.Equal(t, strings.Repeat("console.log('app');", 100), string(body))
+		}()
+	}
+	wg.Wait()
+
+	// loaded and compressed (looking for a precompressed sibling) only once
+	require.Equal(t, single.count("app.js"), concurrent.count("app.js"))
+	require.Equal(t, single.count("app.js.gz"), concurrent.count("app.js.gz"))
+}
+
+func TestStaticFSStreamedByDefaultInLazyMode(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html": {Data: []byte("<html></html>")},
+		"large.txt":  {Data: bytes.Repeat([]byte("a"), 8<<20+1)},
+		"small.txt":  {Data: bytes.Repeat([]byte("a"), 8<<10)},
+	}
+	u := uhttp.NewUHTTP(uhttp.WithGzipCompression(true, 1))
+	require.NoError(t, u.RegisterStaticFS("/", files, uhttp.WithStaticLazyLoading(0)))
+
+	// files above 8 MiB are not loaded into memory, so they are not compressed either
+	res, _ := staticFSGet(t, u, "/large.txt", "gzip")
+	require.Empty(t, res.Header.Get("Content-Encoding"))
+	require.Equal(t, strconv.Itoa(8<<20+1), res.Header.Get("Content-Length"))
+	res, _ = staticFSGet(t, u, "/small.txt", "gzip")
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+
+	// without lazy loading large files are kept in memory and served compressed
+	u = uhttp.NewUHTTP(uhttp.WithGzipCompression(true, 1), uhttp.WithBrotliCompression(false, 0), uhttp.WithDeflateCompression(false, 0))
+	require.NoError(t, u.RegisterStaticFS("/", files))
+	res, body := staticFSGet(t, u, "/large.txt", "gzip")
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	require.Len(t, body, 8<<20+1)
+}
+
+func TestStaticFSStreamed(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	writeStaticFile(t, dir, "index.html", "<html></html>", modTime)
+	writeStaticFile(t, dir, "large.txt", strings.Repeat("0123456789", 100), modTime)
+
+	u := uhttp.NewUHTTP(uhttp.WithGzipCompression(true, 5))
+	require.NoError(t, u.RegisterStaticFS("/", os.DirFS(dir), uhttp.WithStaticStreamThreshold(100)))
+
+	res, body := staticFSGet(t, u, "/large.txt", "gzip")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Empty(t, res.Header.Get("Content-Encoding"))
+	require.Equal(t, "text/plain; charset=utf-8", res.Header.Get("Content-Type"))
+	require.Equal(t, "1000", res.Header.Get("Content-Length"))
+	require.Equal(t, strings.Repeat("0123456789", 100), body)
+
+	// changes are served immediately, files are read on every request
+	writeStaticFile(t, dir, "large.txt", strings.Repeat("9876543210", 100), modTime)
+	req := httptest.NewRequest(http.MethodGet, "/large.txt", nil)
+	req.Header.Set("Range", "bytes=0-4")
+	w := httptest.NewRecorder()
+	u.ServeMux().ServeHTTP(w, req)
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	require.Equal(t, "98765", w.Body.String())
+
+	// streaming does not work without identity
+	res, _ = staticFSGet(t, u, "/large.txt", "gzip, identity;q=0")
+	require.Equal(t, http.StatusNotAcceptable, res.StatusCode)
+
+	// small files are still compressed
+	res, _ = staticFSGet(t, u, "/index.html", "gzip")
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+}
+
+func TestStaticFSStreamedWithoutSeeking(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	f, err := zw.Create("large.txt")
+	require.NoError(t, err)
+	_, err = f.Write([]byte(strings.Repeat("0123456789", 100)))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	zr, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	require.NoError(t, err)
+
+	u := uhttp.NewUHTTP()
+	require.NoError(t, u.RegisterStaticFS("/", zr, uhttp.WithStaticFallback(uhttp.STATIC_FALLBACK_NOT_FOUND), uhttp.WithStaticStreamThreshold(100)))
+
+	request := func(method string, header map[string]string) *http.Response {
+		req := httptest.NewRequest(method, "/large.txt", nil)
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		u.ServeMux().ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	res := request(http.MethodGet, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "1000", res.Header.Get("Content-Length"))
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("0123456789", 100), string(body))
+
+	res = request(http.MethodGet, map[string]string{"If-None-Match": res.Header.Get("ETag")})
+	require.Equal(t, http.StatusNotModified, res.StatusCode)
+
+	res = request(http.MethodHead, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Empty(t, body)
+}
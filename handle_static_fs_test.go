@@ -0,0 +1,430 @@
+package uhttp_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"embed"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/dunv/uhttp"
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed testdata/static
+var embeddedStatic embed.FS
+
+func staticFSGet(t *testing.T, u *uhttp.UHTTP, path string, acceptEncoding string) (*http.Response, string) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	u.ServeMux().ServeHTTP(w, req)
+	res := w.Result()
+	body, err := uhttp.DecodeResponseBody(res)
+	require.NoError(t, err)
+	return res, string(body)
+}
+
+func TestStaticFSEmbed(t *testing.T) {
+	root, err := fs.Sub(embeddedStatic, "testdata/static")
+	require.NoError(t, err)
+
+	u := uhttp.NewUHTTP()
+	require.NoError(t, u.RegisterStaticFS("/", root))
+
+	res, body := staticFSGet(t, u, "/assets/app.js", "br")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "br", res.Header.Get("Content-Encoding"))
+	require.Equal(t, "text/javascript; charset=utf-8", res.Header.Get("Content-Type"))
+	require.Equal(t, `console.log("embedded")`, body)
+	// embed.FS has no modification times
+	require.Empty(t, res.Header.Get("Last-Modified"))
+
+	// single page app fallback
+	res, body = staticFSGet(t, u, "/some/route", "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "text/html; charset=utf-8", res.Header.Get("Content-Type"))
+	require.Equal(t, "<html>embedded</html>", body)
+}
+
+func TestStaticFSZip(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for name, content := range map[string]string{"index.html": "<html>zipped</html>", "css/main.css": ".zipped{}"} {
+		f, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	zr, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	require.NoError(t, err)
+
+	u := uhttp.NewUHTTP()
+	require.NoError(t, u.RegisterStaticFS("/app", zr))
+
+	res, body := staticFSGet(t, u, "/app/css/main.css", "gzip")
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	require.Equal(t, "text/css; charset=utf-8", res.Header.Get("Content-Type"))
+	require.Equal(t, ".zipped{}", body)
+
+	_, body = staticFSGet(t, u, "/app/unknown", "")
+	require.Equal(t, "<html>zipped</html>", body)
+}
+
+func TestStaticFSPrecompressedAndIndex(t *testing.T) {
+	var precompressed bytes.Buffer
+	gw := gzip.NewWriter(&precompressed)
+	_, err := gw.Write([]byte(".precompressed{}"))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	fsys := fstest.MapFS{
+		"app.html":    {Data: []byte("<html>app</html>")},
+		"main.css":    {Data: []byte(".test{}")},
+		"main.css.gz": {Data: precompressed.Bytes()},
+		// no base file, this is an archive and not a precompressed variant
+		"backup.tar.gz": {Data: precompressed.Bytes()},
+	}
+
+	// the index file must exist
+	require.ErrorContains(t, uhttp.NewUHTTP().RegisterStaticFS("/", fsys), "could not find index.html")
+
+	u := uhttp.NewUHTTP()
+	require.NoError(t, u.RegisterStaticFS("/", fsys, uhttp.WithStaticIndexFile("app.html")))
+
+	res, body := staticFSGet(t, u, "/main.css", "gzip")
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	require.Equal(t, ".precompressed{}", body)
+
+	// precompressed siblings are not served themselves
+	_, body = staticFSGet(t, u, "/main.css.gz", "")
+	require.Equal(t, "<html>app</html>", body)
+
+	// standalone compressed files are served as they are
+	res, body = staticFSGet(t, u, "/backup.tar.gz", "gzip")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "application/gzip", res.Header.Get("Content-Type"))
+	require.Empty(t, res.Header.Get("Content-Encoding"))
+	require.Equal(t, precompressed.String(), body)
+}
+
+func TestStaticFSInstancesAreIsolated(t *testing.T) {
+	u1 := uhttp.NewUHTTP()
+	require.NoError(t, u1.RegisterStaticFS("/", fstest.MapFS{"index.html": {Data: []byte("one")}}))
+	u2 := uhttp.NewUHTTP()
+	require.NoError(t, u2.RegisterStaticFS("/", fstest.MapFS{"index.html": {Data: []byte("two")}}))
+
+	_, body := staticFSGet(t, u1, "/index.html", "")
+	require.Equal(t, "one", body)
+	_, body = staticFSGet(t, u2, "/index.html", "")
+	require.Equal(t, "two", body)
+
+	// the exported handler serves the instance's files at "/"
+	w := httptest.NewRecorder()
+	uhttp.StaticFilesHandler(u2)(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, "two", w.Body.String())
+
+	w = httptest.NewRecorder()
+	uhttp.StaticFilesHandler(uhttp.NewUHTTP())(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestStaticFSPrefixesAndFallbacks(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	require.NoError(t, u.RegisterStaticFS("/app/", fstest.MapFS{
+		"index.html": {Data: []byte("app")},
+	}))
+	require.NoError(t, u.RegisterStaticFS("/docs/", fstest.MapFS{
+		"index.html":       {Data: []byte("docs")},
+		"guide/index.html": {Data: []byte("guide")},
+	}, uhttp.WithStaticFallback(uhttp.STATIC_FALLBACK_NOT_FOUND)))
+	require.NoError(t, u.RegisterStaticFS("/assets", fstest.MapFS{
+		"logo.svg": {Data: []byte("<svg></svg>")},
+	}, uhttp.WithStaticFallbackHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))))
+	require.ErrorContains(t, u.RegisterStaticFS("/app", fstest.MapFS{"index.html": {}}), "already registered")
+
+	for path, expected := range map[string]struct {
+		statusCode int
+		body       string
+	}{
+		"/app/":            {statusCode: http.StatusOK, body: "app"},
+		"/app/some/route":  {statusCode: http.StatusOK, body: "app"},
+		"/docs/":           {statusCode: http.StatusOK, body: "docs"},
+		"/docs/guide/":     {statusCode: http.StatusOK, body: "guide"},
+		"/docs/missing":    {statusCode: http.StatusNotFound, body: `{"error":"/docs/missing not found"}` + "\n"},
+		"/assets/logo.svg": {statusCode: http.StatusOK, body: "<svg></svg>"},
+		"/assets/missing":  {statusCode: http.StatusTeapot, body: ""},
+	} {
+		res, body := staticFSGet(t, u, path, "")
+		require.Equal(t, expected.statusCode, res.StatusCode, path)
+		require.Equal(t, expected.body, body, path)
+	}
+
+	res, _ := staticFSGet(t, u, "/docs/missing", "")
+	require.Equal(t, "application/json", res.Header.Get("Content-Type"))
+}
+
+func TestStaticFilesRootAppearsTwice(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "dist")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "dist"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "index.html"), []byte("<html></html>"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "dist", "dist.js"), []byte("dist"), 0644))
+
+	u := uhttp.NewUHTTP()
+	require.NoError(t, u.RegisterStaticFilesHandler(root))
+
+	_, body := staticFSGet(t, u, "/dist/dist.js", "")
+	require.Equal(t, "dist", body)
+}
+
+func setupStaticRangeTest(t *testing.T) (*uhttp.UHTTP, func(method string, header map[string]string) *http.Response) {
+	u := uhttp.NewUHTTP()
+	require.NoError(t, u.RegisterStaticFS("/", fstest.MapFS{
+		"index.html": {Data: []byte("<html></html>")},
+		"data.txt":   {Data: []byte("0123456789abcdefghij"), ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}))
+	return u, func(method string, header map[string]string) *http.Response {
+		req := httptest.NewRequest(method, "/data.txt", nil)
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		u.ServeMux().ServeHTTP(w, req)
+		return w.Result()
+	}
+}
+
+func TestStaticFSRange(t *testing.T) {
+	_, request := setupStaticRangeTest(t)
+
+	res := request(http.MethodGet, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "bytes", res.Header.Get("Accept-Ranges"))
+	require.Equal(t, "20", res.Header.Get("Content-Length"))
+	require.Equal(t, "Tue, 02 Jan 2024 03:04:05 GMT", res.Header.Get("Last-Modified"))
+
+	// ranges are served from the uncompressed content
+	res = request(http.MethodGet, map[string]string{"Range": "bytes=5-9", "Accept-Encoding": "gzip"})
+	require.Equal(t, http.StatusPartialContent, res.StatusCode)
+	require.Empty(t, res.Header.Get("Content-Encoding"))
+	require.Equal(t, "bytes 5-9/20", res.Header.Get("Content-Range"))
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, "56789", string(body))
+
+	res = request(http.MethodGet, map[string]string{"Range": "bytes=-3"})
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, "hij", string(body))
+
+	res = request(http.MethodGet, map[string]string{"Range": "bytes=100-"})
+	require.Equal(t, http.StatusRequestedRangeNotSatisfiable, res.StatusCode)
+	require.Equal(t, "bytes */20", res.Header.Get("Content-Range"))
+}
+
+func TestStaticFSMultipartRange(t *testing.T) {
+	_, request := setupStaticRangeTest(t)
+
+	res := request(http.MethodGet, map[string]string{"Range": "bytes=0-1,10-11"})
+	require.Equal(t, http.StatusPartialContent, res.StatusCode)
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/byteranges", mediaType)
+
+	parts := []string{}
+	reader := multipart.NewReader(res.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(part)
+		require.NoError(t, err)
+		parts = append(parts, part.Header.Get("Content-Range")+":"+string(content))
+	}
+	require.Equal(t, []string{"bytes 0-1/20:01", "bytes 10-11/20:ab"}, parts)
+}
+
+func TestStaticFSIfRange(t *testing.T) {
+	_, request := setupStaticRangeTest(t)
+	etag := request(http.MethodGet, nil).Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	for ifRange, expected := range map[string]int{
+		etag:                            http.StatusPartialContent,
+		`"outdated"`:                    http.StatusOK,
+		"Tue, 02 Jan 2024 03:04:05 GMT": http.StatusPartialContent,
+		"Mon, 01 Jan 2024 00:00:00 GMT": http.StatusOK,
+	} {
+		res := request(http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": ifRange})
+		require.Equal(t, expected, res.StatusCode, ifRange)
+	}
+}
+
+func TestStaticFSConditionalAndHead(t *testing.T) {
+	_, request := setupStaticRangeTest(t)
+
+	res := request(http.MethodGet, map[string]string{"Accept-Encoding": "gzip"})
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(len(body)), res.Header.Get("Content-Length"))
+	etag := res.Header.Get("ETag")
+
+	res = request(http.MethodGet, map[string]string{"Accept-Encoding": "gzip", "If-None-Match": etag})
+	require.Equal(t, http.StatusNotModified, res.StatusCode)
+	require.Equal(t, etag, res.Header.Get("ETag"))
+
+	res = request(http.MethodHead, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "20", res.Header.Get("Content-Length"))
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Empty(t, body)
+}
+
+func TestStaticFSCacheControlRules(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	require.NoError(t, u.RegisterStaticFS("/", fstest.MapFS{
+		"index.html":                   {Data: []byte("<html></html>")},
+		"assets/main.3f2a9c1b.js":      {Data: []byte("main")},
+		"assets/index-B4x9aZkQ.css":    {Data: []byte("index")},
+		"assets/OpenSans-SemiBold.ttf": {Data: []byte("font")},
+		"assets/jquery-3.6.0.min.js":   {Data: []byte("jquery")},
+		"assets/Roboto-Regular12.ttf":  {Data: []byte("font")},
+		"assets/invoice-20240115.pdf":  {Data: []byte("invoice")},
+		"assets/hero-1920x1080.jpg":    {Data: []byte("hero")},
+		"docs/guide.pdf":               {Data: []byte("guide")},
+		"robots.txt":                   {Data: []byte("robots")},
+	}, uhttp.WithStaticRules(
+		uhttp.StaticRule{Glob: "index.html", CacheControl: "no-cache", Header: http.Header{"Content-Security-Policy": {"default-src 'self'"}}},
+		uhttp.StaticRule{Glob: "assets/*", Header: http.Header{"X-Content-Type-Options": {"nosniff"}}},
+		uhttp.StaticRule{Regexp: regexp.MustCompile(`^docs/.*\.pdf$`), CacheControl: "public, max-age=3600"},
+	)))
+
+	for path, expected := range map[string]struct {
+		cacheControl string
+		nosniff      bool
+	}{
+		"/index.html":                   {cacheControl: "no-cache"},
+		"/unknown/route":                {cacheControl: "no-cache"},
+		"/assets/main.3f2a9c1b.js":      {cacheControl: uhttp.STATIC_CACHE_CONTROL_IMMUTABLE, nosniff: true},
+		"/assets/index-B4x9aZkQ.css":    {cacheControl: uhttp.STATIC_CACHE_CONTROL_IMMUTABLE, nosniff: true},
+		"/assets/OpenSans-SemiBold.ttf": {nosniff: true},
+		"/assets/jquery-3.6.0.min.js":   {nosniff: true},
+		"/assets/Roboto-Regular12.ttf":  {nosniff: true},
+		"/assets/invoice-20240115.pdf":  {nosniff: true},
+		"/assets/hero-1920x1080.jpg":    {nosniff: true},
+		"/docs/guide.pdf":               {cacheControl: "public, max-age=3600"},
+		"/robots.txt":                   {},
+	} {
+		res, _ := staticFSGet(t, u, path, "")
+		require.Equal(t, expected.cacheControl, res.Header.Get("Cache-Control"), path)
+		if expected.nosniff {
+			require.Equal(t, "nosniff", res.Header.Get("X-Content-Type-Options"), path)
+		} else {
+			require.Empty(t, res.Header.Get("X-Content-Type-Options"), path)
+		}
+	}
+
+	res, _ := staticFSGet(t, u, "/", "")
+	require.Equal(t, "default-src 'self'", res.Header.Get("Content-Security-Policy"))
+
+	// headers are kept for 304
+	etag := res.Header.Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, "/index.html", nil)
+	req.Header.Set("If-None-Match", etag)
+	w := httptest.NewRecorder()
+	u.ServeMux().ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotModified, w.Code)
+	require.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+}
+
+func TestStaticFSFingerprintDetectionDisabled(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	require.NoError(t, u.RegisterStaticFS("/", fstest.MapFS{
+		"index.html":       {Data: []byte("<html></html>")},
+		"main.3f2a9c1b.js": {Data: []byte("main")},
+	}, uhttp.WithStaticFingerprintCacheControl("")))
+
+	res, _ := staticFSGet(t, u, "/main.3f2a9c1b.js", "")
+	require.Empty(t, res.Header.Get("Cache-Control"))
+}
+
+func TestStaticFSContentTypes(t *testing.T) {
+	u := uhttp.NewUHTTP(uhttp.WithGzipCompression(true, 5))
+	require.NoError(t, u.RegisterStaticFS("/", fstest.MapFS{
+		"index.html":           {Data: []byte("<html></html>")},
+		"app.mjs":              {Data: []byte("export {}")},
+		"app.wasm":             {Data: []byte("\x00asm")},
+		"data.json":            {Data: []byte("{}")},
+		"site.webmanifest":     {Data: []byte("{}")},
+		"image.AVIF":           {Data: []byte("avif")},
+		"font.woff2":           {Data: []byte("woff2")},
+		"model.glb":            {Data: []byte("glTF")},
+		"unknown":              {Data: []byte("plain text")},
+		"pre-charset.override": {Data: []byte("text")},
+	}, uhttp.WithStaticMimeTypes(map[string]string{
+		"GLB":       "model/gltf-binary",
+		".override": "text/plain; charset=iso-8859-1",
+	})))
+
+	for path, expected := range map[string]string{
+		"/app.mjs":              "text/javascript; charset=utf-8",
+		"/app.wasm":             "application/wasm",
+		"/data.json":            "application/json; charset=utf-8",
+		"/site.webmanifest":     "application/manifest+json; charset=utf-8",
+		"/image.AVIF":           "image/avif",
+		"/font.woff2":           "font/woff2",
+		"/model.glb":            "model/gltf-binary",
+		"/unknown":              "text/plain; charset=utf-8",
+		"/pre-charset.override": "text/plain; charset=iso-8859-1",
+	} {
+		res, _ := staticFSGet(t, u, path, "")
+		require.Equal(t, expected, res.Header.Get("Content-Type"), path)
+	}
+
+	// already compressed types are not compressed again
+	for path, expected := range map[string]string{
+		"/app.wasm":   "gzip",
+		"/data.json":  "gzip",
+		"/image.AVIF": "",
+		"/font.woff2": "",
+	} {
+		res, _ := staticFSGet(t, u, path, "gzip")
+		require.Equal(t, expected, res.Header.Get("Content-Encoding"), path)
+	}
+
+	// unless the client does not accept them uncompressed
+	res, body := staticFSGet(t, u, "/image.AVIF", "gzip, identity;q=0")
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	require.Equal(t, "avif", body)
+}
+
+func TestStaticFSCharsetDisabled(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	require.NoError(t, u.RegisterStaticFS("/", fstest.MapFS{
+		"index.html": {Data: []byte("<html></html>")},
+	}, uhttp.WithStaticCharset("")))
+
+	res, _ := staticFSGet(t, u, "/", "")
+	require.Equal(t, "text/html", res.Header.Get("Content-Type"))
+}
@@ -74,6 +74,12 @@ func (h Handler) handlerFuncExcludeMiddlewareByName(u *UHTTP, exclude *string) h
 	// Add uhttp
 	c = chain(c, withUHTTP(u))
 
+	// Add HTTP caching (applied when rendering)
+	c = chain(c, httpCachingMiddleware(u, h.opts))
+
+	// Add compression policy (applied when rendering)
+	c = chain(c, compressionMiddleware(u, h.opts))
+
 	// Add original responseWriter
 	c = chain(c, withOriginalResponseWriter(u))
 
@@ -3,7 +3,10 @@ package uhttp
 import (
 	"context"
 	"log"
+	"net/http"
 	"time"
+
+	"github.com/dunv/uhttp/cache"
 )
 
 type HandlerOption interface {
@@ -25,6 +28,11 @@ type handlerOptions struct {
 
 	requiredGet    R
 	optionalGet    R
+	requiredHeader R
+	optionalHeader R
+	requiredCookie R
+	optionalCookie R
+	paramsModel    interface{}
 	middlewares    []Middleware
 	preProcess     func(ctx context.Context) error
 	timeout        time.Duration
@@ -37,9 +45,35 @@ type handlerOptions struct {
 	cacheAutomaticUpdatesSkipMiddleware *string
 	cacheAutomaticUpdatesParameters     []map[string]string
 	cacheMaxAge                         time.Duration
+	cacheStore                          cache.Store
+	cacheBudget                         cache.Budget
+	cacheCoalescing                     bool
+	cacheCoalescingTimeout              time.Duration
+	cacheStaleWhileRevalidate           time.Duration
+	cacheStaleIfError                   time.Duration
+	cacheKeyHeaders                     []string
+	cacheKeyCookies                     []string
+	cacheKeyIgnoredParams               []string
+	cacheKeyPrincipal                   bool
+	cacheKeyIgnoreCredentials           bool
+	cacheKeyFunc                        func(r *http.Request) string
+	cacheTags                           []string
+	cachePredicate                      func(r *http.Request, statusCode int, model interface{}) bool
+	cachePost                           bool
+
+	etagMode     ETagMode
+	cacheControl string
+
+	compressionLevels  *CompressionLevels
+	compressionMinSize *int
 
 	debugRawRequestBody func([]byte)
 
+	uploadMaxFileSize  int64
+	uploadMaxTotalSize int64
+	uploadMaxMemory    int64
+	uploadTempDir      string
+
 	loggingDisable bool
 
 	// Read-only
@@ -63,7 +97,12 @@ func newFuncHandlerOption(f func(*handlerOptions)) *funcHandlerOption {
 func withDefaults() HandlerOption {
 	return newFuncHandlerOption(func(o *handlerOptions) {
 		o.cacheBypassHeader = "X-UHTTP-BYPASS-CACHE"
+		o.cacheCoalescing = true
+		o.etagMode = ETAG_WEAK
 		o.debugRawRequestBody = func([]byte) {}
+		o.uploadMaxFileSize = 32 << 20
+		o.uploadMaxTotalSize = 64 << 20
+		o.uploadMaxMemory = 1 << 20
 	})
 }
 
@@ -154,6 +193,46 @@ func WithOptionalGet(r R) HandlerOption {
 	})
 }
 
+// Add required headers which will be parsed and validated (same types as for query-parameters)
+// The framework will make sure they are present
+func WithRequiredHeader(r R) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.requiredHeader = r
+	})
+}
+
+// Add optional headers which will be parsed and validated
+func WithOptionalHeader(r R) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.optionalHeader = r
+	})
+}
+
+// Add required cookies which will be parsed and validated (same types as for query-parameters)
+// The framework will make sure they are present
+func WithRequiredCookie(r R) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.requiredCookie = r
+	})
+}
+
+// Add optional cookies which will be parsed and validated
+func WithOptionalCookie(r R) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.optionalCookie = r
+	})
+}
+
+// Bind query-parameters, headers and cookies into a struct (the model passed here is only used for its type)
+// Fields are declared with struct-tags, e.g. `query:"from" required:"true" default:"2021-01-01" format:"shortDate"`
+// or `header:"X-Tenant"`
+// The populated model can be retrieved with GetParamsModel
+func WithParamsModel(m interface{}) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.paramsModel = m
+	})
+}
+
 // Add additional middlewares
 func WithMiddlewares(m ...Middleware) HandlerOption {
 	return newFuncHandlerOption(func(o *handlerOptions) {
@@ -213,6 +292,146 @@ func WithCachePersistEncodings() HandlerOption {
 	})
 }
 
+// Keep the cache of this handler in a specific store (default: in memory, see WithDefaultCacheStore)
+func WithCacheStore(store cache.Store) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheStore = store
+	})
+}
+
+// Budget for the cache of this handler, if it is exceeded entries are evicted
+// according to the policy (cache.EVICTION_LRU or cache.EVICTION_LFU). zero values are unlimited
+func WithCacheBudget(maxBytes uint64, maxEntries int, policy cache.EvictionPolicy) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheBudget = cache.Budget{MaxBytes: maxBytes, MaxEntries: maxEntries, Policy: policy}
+	})
+}
+
+// Concurrent cache-misses for the same request are collapsed into a single execution of the handler
+// whose result (also errors) is shared with all waiting requests (default: enabled)
+// waiting requests execute the handler themselves after waitTimeout (0 waits as long as the execution takes)
+func WithCacheCoalescing(enable bool, waitTimeout time.Duration) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheCoalescing = enable
+		o.cacheCoalescingTimeout = waitTimeout
+	})
+}
+
+// Expired entries are served for another duration d while they are refreshed in the background
+// (CACHE_HEADER is set to CACHE_HEADER_STALE_WHILE_REVALIDATE)
+func WithCacheStaleWhileRevalidate(d time.Duration) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheStaleWhileRevalidate = d
+	})
+}
+
+// Expired entries are served for another duration d if the handler fails (statusCode >= 500) or panics
+// (CACHE_HEADER is set to CACHE_HEADER_STALE_IF_ERROR)
+func WithCacheStaleIfError(d time.Duration) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheStaleIfError = d
+	})
+}
+
+// Headers which are part of the cache-key (they are added to the Vary-header of the response)
+// in addition to the credentials (see WithCacheKeyIgnoreCredentials)
+func WithCacheKeyHeaders(headers ...string) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheKeyHeaders = headers
+	})
+}
+
+// Cookies which are part of the cache-key (they add Cookie to the Vary-header of the response)
+// other cookies are not, handlers which authenticate with a session-cookie have to declare it here
+func WithCacheKeyCookies(cookies ...string) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheKeyCookies = cookies
+	})
+}
+
+// Params which are not part of the cache-key (e.g. tracking-params or cache-busters)
+func WithCacheKeyIgnoredParams(params ...string) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheKeyIgnoredParams = params
+	})
+}
+
+// Responses are shared across credentials: the Authorization-header is not part of the cache-key.
+// By default it is, so users never get each other's responses. Cookies are only part of the key if they
+// are declared with WithCacheKeyCookies. Use WithCacheKeyPrincipal to key by the authenticated user instead
+func WithCacheKeyIgnoreCredentials() HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheKeyIgnoreCredentials = true
+	})
+}
+
+// The authenticated principal (see GetPrincipal) is part of the cache-key
+func WithCacheKeyPrincipal() HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheKeyPrincipal = true
+	})
+}
+
+// The result of keyFunc is part of the cache-key (in addition to everything else)
+func WithCacheKeyFunc(keyFunc func(r *http.Request) string) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheKeyFunc = keyFunc
+	})
+}
+
+// Tags of all cached responses of this handler (see UHTTP.Cache().InvalidateTags)
+// tags which depend on the request can be added with AddCacheTags
+func WithCacheTags(tags ...string) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheTags = tags
+	})
+}
+
+// Decides per request and response whether it is cached
+// it replaces the default (only successful responses, see WithCacheFailedRequests)
+func WithCachePredicate(predicate func(r *http.Request, statusCode int, model interface{}) bool) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cachePredicate = predicate
+	})
+}
+
+// POST-requests are cached as well (for queries which do not modify anything, the body is part of the key)
+// multipart/form-data requests (uploads) are never cached
+func WithCachePost() HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cachePost = true
+	})
+}
+
+// ETags of successful GET-responses (default: ETAG_WEAK), If-None-Match is answered with 304
+func WithETag(mode ETagMode) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.etagMode = mode
+	})
+}
+
+// Cache-Control of successful GET-responses
+// default: derived from WithCache (remaining max-age, stale-while-revalidate and stale-if-error), not set for uncached handlers
+func WithCacheControl(cacheControl string) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.cacheControl = cacheControl
+	})
+}
+
+// Compression levels of this handler's responses, unset levels are taken from WithDynamicCompression
+func WithCompressionLevels(levels CompressionLevels) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.compressionLevels = &levels
+	})
+}
+
+// Responses of this handler smaller than minSize bytes are not compressed (default: see WithDynamicCompression)
+func WithCompressionMinSize(minSize int) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.compressionMinSize = &minSize
+	})
+}
+
 // Disable access-log for this handler
 func WithDisableAccessLogging() HandlerOption {
 	return newFuncHandlerOption(func(o *handlerOptions) {
@@ -221,8 +440,27 @@ func WithDisableAccessLogging() HandlerOption {
 }
 
 // Register callback for raw request-body (for debugging)
+// multipart/form-data bodies are not kept, the callback gets their form-values urlencoded (without files)
 func WithDebugRawRequestBody(fn func([]byte)) HandlerOption {
 	return newFuncHandlerOption(func(o *handlerOptions) {
 		o.debugRawRequestBody = fn
 	})
 }
+
+// Limits for multipart/form-data uploads, exceeding them results in 413 Request Entity Too Large
+// (default: 32MiB per file, 64MiB in total)
+func WithUploadLimits(maxFileSize int64, maxTotalSize int64) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.uploadMaxFileSize = maxFileSize
+		o.uploadMaxTotalSize = maxTotalSize
+	})
+}
+
+// Uploaded files up to maxMemory are kept in memory, larger ones are streamed into tempDir
+// and removed after the request (default: 1MiB, os.TempDir())
+func WithUploadStorage(tempDir string, maxMemory int64) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.uploadTempDir = tempDir
+		o.uploadMaxMemory = maxMemory
+	})
+}
@@ -2,6 +2,8 @@ package uhttp
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"io"
 	"net/http"
 	"runtime"
@@ -41,3 +43,12 @@ func relevantCaller() runtime.Frame {
 	}
 	return frame
 }
+
+// random identifier of an instance (e.g. a replica)
+func newInstanceID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
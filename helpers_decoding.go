@@ -10,6 +10,7 @@ import (
 	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/flate"
 	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
 )
 
 // Wraps a reader in the correct decoder based on http-headers
@@ -27,6 +28,12 @@ func DecodingReader(header http.Header, body io.ReadCloser) (io.ReadCloser, erro
 		reader = io.NopCloser(brotli.NewReader(body))
 	case "deflate":
 		reader = flate.NewReader(body)
+	case "zstd":
+		zr, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("could not decode zstd response (%s)", err)
+		}
+		reader = zr.IOReadCloser()
 	default:
 		reader = body
 	}
@@ -34,7 +41,11 @@ func DecodingReader(header http.Header, body io.ReadCloser) (io.ReadCloser, erro
 	return reader, nil
 }
 
-func decodeRequestBody(r *http.Request, model interface{}) error {
+func decodeRequestBody(r *http.Request, model interface{}, formFields []paramField) error {
+	if isContentType(r, CONTENT_TYPE_FORM_URLENCODED) {
+		return decodeFormRequestBody(r, model, formFields)
+	}
+
 	reader, err := DecodingReader(r.Header, r.Body)
 	if err != nil {
 		return fmt.Errorf("err parsing request (err getting reader %s)", err)
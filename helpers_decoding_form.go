@@ -0,0 +1,278 @@
+package uhttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+)
+
+const (
+	CONTENT_TYPE_FORM_URLENCODED = "application/x-www-form-urlencoded"
+	CONTENT_TYPE_MULTIPART_FORM  = "multipart/form-data"
+)
+
+var errUploadTooLarge = errors.New("upload too large")
+
+// A file which was uploaded with a multipart/form-data request
+// small files are kept in memory, larger ones are streamed to a temporary file which is removed after the request
+type UploadedFile struct {
+	FieldName string
+	FileName  string
+	Size      int64
+	// as specified by the client
+	DeclaredContentType string
+	// detected from the file's content
+	ContentType string
+
+	content []byte
+	path    string
+}
+
+// Open the file's content for reading
+func (f *UploadedFile) Open() (io.ReadCloser, error) {
+	if f.path != "" {
+		return os.Open(f.path)
+	}
+	return io.NopCloser(bytes.NewReader(f.content)), nil
+}
+
+// Path of the temporary file (empty if the file is kept in memory)
+func (f *UploadedFile) Path() string {
+	return f.path
+}
+
+// All uploaded files by fieldName
+type UploadedFiles map[string][]*UploadedFile
+
+func (f UploadedFiles) remove() {
+	for _, files := range f {
+		for _, file := range files {
+			if file.path != "" {
+				_ = os.Remove(file.path)
+			}
+		}
+	}
+}
+
+// GetUploadedFiles returns all files which were uploaded for a fieldName
+func GetUploadedFiles(key string, r *http.Request) []*UploadedFile {
+	return GetUploadedFilesFromContext(key, r.Context())
+}
+
+func GetUploadedFilesFromContext(key string, ctx context.Context) []*UploadedFile {
+	files, ok := ctx.Value(CtxKeyUploadedFiles).(UploadedFiles)
+	if !ok {
+		return nil
+	}
+	return files[key]
+}
+
+// GetUploadedFile returns the first file which was uploaded for a fieldName (nil if there is none)
+func GetUploadedFile(key string, r *http.Request) *UploadedFile {
+	files := GetUploadedFiles(key, r)
+	if len(files) == 0 {
+		return nil
+	}
+	return files[0]
+}
+
+func isContentType(r *http.Request, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == contentType
+}
+
+// decodeFormRequestBody decodes an application/x-www-form-urlencoded body into the model
+func decodeFormRequestBody(r *http.Request, model interface{}, fields []paramField) error {
+	reader, err := DecodingReader(r.Header, r.Body)
+	if err != nil {
+		return fmt.Errorf("err parsing request (err getting reader %s)", err)
+	}
+	defer r.Body.Close()
+	defer reader.Close()
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("err parsing request (err reading %s)", err)
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return fmt.Errorf("err parsing request (err decoding %s)", err)
+	}
+
+	return decodeForm(values, nil, model, fields)
+}
+
+// decodeMultipartRequestBody streams a multipart/form-data body, files are kept in memory or in the tempDir
+// the returned files need to be removed by the caller (also if an error is returned)
+func decodeMultipartRequestBody(r *http.Request, opts handlerOptions, model interface{}, fields []paramField) (UploadedFiles, error) {
+	files := UploadedFiles{}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return files, fmt.Errorf("err parsing request (err getting reader %s)", err)
+	}
+
+	values := url.Values{}
+	total := int64(0)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return files, fmt.Errorf("err parsing request (err reading part %s)", err)
+		}
+
+		fieldName := part.FormName()
+		if fieldName == "" {
+			part.Close()
+			continue
+		}
+
+		// regular form-values
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, opts.uploadMaxTotalSize-total+1))
+			part.Close()
+			if err != nil {
+				return files, fmt.Errorf("err parsing request (err reading part %s)", err)
+			}
+			total += int64(len(value))
+			if total > opts.uploadMaxTotalSize {
+				return files, fmt.Errorf("%w (max %d bytes in total)", errUploadTooLarge, opts.uploadMaxTotalSize)
+			}
+			values.Add(fieldName, string(value))
+			continue
+		}
+
+		file, err := storeUploadedFile(part, opts, opts.uploadMaxTotalSize-total)
+		part.Close()
+		if err != nil {
+			return files, err
+		}
+		total += file.Size
+		files[fieldName] = append(files[fieldName], file)
+	}
+
+	// the raw body is not kept (files can be large), the callback gets the form-values (urlencoded) instead
+	opts.debugRawRequestBody([]byte(values.Encode()))
+	return files, decodeForm(values, files, model, fields)
+}
+
+// storeUploadedFile keeps the file in memory up to uploadMaxMemory, everything larger goes into the tempDir
+func storeUploadedFile(part *multipart.Part, opts handlerOptions, remainingTotal int64) (*UploadedFile, error) {
+	file := &UploadedFile{
+		FieldName:           part.FormName(),
+		FileName:            part.FileName(),
+		DeclaredContentType: part.Header.Get("Content-Type"),
+	}
+
+	limit := opts.uploadMaxFileSize
+	tooLarge := fmt.Errorf("%w (max %d bytes per file)", errUploadTooLarge, opts.uploadMaxFileSize)
+	if remainingTotal < limit {
+		limit = remainingTotal
+		tooLarge = fmt.Errorf("%w (max %d bytes in total)", errUploadTooLarge, opts.uploadMaxTotalSize)
+	}
+
+	var buffer bytes.Buffer
+	n, err := io.CopyN(&buffer, part, opts.uploadMaxMemory+1)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("err parsing request (err reading file %s)", err)
+	}
+	file.ContentType = http.DetectContentType(buffer.Bytes())
+
+	if n <= opts.uploadMaxMemory {
+		if n > limit {
+			return nil, tooLarge
+		}
+		file.content = buffer.Bytes()
+		file.Size = n
+		return file, nil
+	}
+
+	tmp, err := os.CreateTemp(opts.uploadTempDir, "uhttp-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("could not store uploaded file (%s)", err)
+	}
+	defer tmp.Close()
+
+	written, err := io.Copy(tmp, io.MultiReader(&buffer, io.LimitReader(part, limit-n+1)))
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, fmt.Errorf("could not store uploaded file (%s)", err)
+	}
+	if written > limit {
+		_ = os.Remove(tmp.Name())
+		return nil, tooLarge
+	}
+
+	file.path = tmp.Name()
+	file.Size = written
+	return file, nil
+}
+
+// decodeForm populates the model from form-values (and files)
+// supported models are structs (with form-tags, inspected once as fields), map[string]string, map[string][]string,
+// url.Values and map[string]interface{}
+func decodeForm(values url.Values, files UploadedFiles, model interface{}, fields []paramField) error {
+	switch typed := model.(type) {
+	case *map[string]string:
+		decoded := map[string]string{}
+		for key := range values {
+			decoded[key] = values.Get(key)
+		}
+		*typed = decoded
+		return nil
+	case *map[string][]string:
+		*typed = values
+		return nil
+	case *url.Values:
+		*typed = values
+		return nil
+	case *map[string]interface{}:
+		decoded := map[string]interface{}{}
+		for key := range values {
+			decoded[key] = values.Get(key)
+		}
+		*typed = decoded
+		return nil
+	}
+
+	modelValue := reflect.ValueOf(model)
+	if modelValue.Kind() != reflect.Pointer || modelValue.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("err parsing request (model %T cannot be decoded from a form)", model)
+	}
+
+	if err := bindParamsInto(modelValue, fields, map[string]url.Values{TAG_FORM: values}, map[string]R{TAG_FORM: {}}); err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		if !field.isFile {
+			continue
+		}
+		fieldFiles := files[field.key]
+		if len(fieldFiles) == 0 {
+			if field.required {
+				return fmt.Errorf("required file %s not present", field.key)
+			}
+			continue
+		}
+		target := modelValue.Elem().FieldByIndex(field.index)
+		if target.Type() == uploadedFileType {
+			target.Set(reflect.ValueOf(fieldFiles[0]))
+		} else {
+			target.Set(reflect.ValueOf(fieldFiles))
+		}
+	}
+
+	return nil
+}
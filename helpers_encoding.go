@@ -2,22 +2,24 @@ package uhttp
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
-
-	"github.com/andybalholm/brotli"
-	"github.com/klauspost/compress/flate"
-	"github.com/klauspost/compress/gzip"
 )
 
 const (
 	HEADER_ACCEPT_ENCODING  = "Accept-Encoding"
 	HEADER_CONTENT_ENCODING = "Content-Encoding"
+	HEADER_VARY             = "Vary"
+	HEADER_CONTENT_LENGTH   = "Content-Length"
 	ENCODING_PLAIN          = ""
 	ENCODING_BROTLI         = "br"
 	ENCODING_GZIP           = "gzip"
 	ENCODING_DEFLATE        = "deflate"
+	ENCODING_ZSTD           = "zstd"
 )
 
 type nopCloser struct{ internal io.Writer }
@@ -29,42 +31,157 @@ func (n nopCloser) Close() error {
 	return nil
 }
 
-func (u *UHTTP) encodingWriter(w io.Writer, encoding string) io.WriteCloser {
-	switch encoding {
-	case ENCODING_BROTLI:
-		return brotli.NewWriterLevel(w, u.opts.brotliCompressionLevel)
-	case ENCODING_GZIP:
-		// we check that we are using a supported level when assigning the option
-		ww, _ := gzip.NewWriterLevel(w, u.opts.gzipCompressionLevel)
-		return ww
-	case ENCODING_DEFLATE:
-		// we check that we are using a supported level when assigning the option
-		ww, _ := flate.NewWriter(w, u.opts.deflateCompressionLevel)
-		return ww
-	default:
-		return nopCloser{w}
+// enabledEncodings in the order of the server's preference
+// zstd is preferred (if enabled), it is much cheaper to compress than brotli with a similar ratio
+func (u *UHTTP) enabledEncodings() []string {
+	encodings := []string{}
+	if u.opts.enableZstd {
+		encodings = append(encodings, ENCODING_ZSTD)
+	}
+	if u.opts.enableBrotli {
+		encodings = append(encodings, ENCODING_BROTLI)
+	}
+	if u.opts.enableGzip {
+		encodings = append(encodings, ENCODING_GZIP)
+	}
+	if u.opts.enableDeflate {
+		encodings = append(encodings, ENCODING_DEFLATE)
+	}
+	return encodings
+}
+
+// determineEncoding negotiates the content-coding of a response (RFC 9110, section 12.5.3)
+// the coding with the highest qvalue wins, ties are broken by the server's preference
+// bodies smaller than the compression policy's minSize are not encoded (if identity is acceptable)
+// ok is false if neither an enabled coding nor identity is acceptable
+func (u *UHTTP) determineEncoding(r *http.Request, statusCode int, size int) (encoding string, ok bool) {
+	// responses without content are never encoded
+	if statusCode < http.StatusOK || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		return ENCODING_PLAIN, true
+	}
+
+	// without the header any coding would be acceptable, identity is the safest choice
+	if _, ok := r.Header[HEADER_ACCEPT_ENCODING]; !ok {
+		return ENCODING_PLAIN, true
+	}
+
+	accepted := parseAcceptEncoding(strings.Join(r.Header.Values(HEADER_ACCEPT_ENCODING), ","))
+	best, bestQ := ENCODING_PLAIN, 0.0
+	for _, encoding := range u.enabledEncodings() {
+		if q, _ := accepted.quality(encoding); q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	// identity is implicitly acceptable, but only chosen if it was explicitly preferred
+	identityQ, explicit := accepted.quality("identity")
+	if identityQ > 0 && size < u.getCompressionPolicy(r).minSize {
+		return ENCODING_PLAIN, true
+	}
+	if best != ENCODING_PLAIN && (!explicit || bestQ >= identityQ) {
+		return best, true
+	}
+	return ENCODING_PLAIN, identityQ > 0
+}
+
+// identityAcceptable is true if the client accepts unencoded content
+func identityAcceptable(r *http.Request) bool {
+	if _, ok := r.Header[HEADER_ACCEPT_ENCODING]; !ok {
+		return true
 	}
+	q, _ := parseAcceptEncoding(strings.Join(r.Header.Values(HEADER_ACCEPT_ENCODING), ",")).quality("identity")
+	return q > 0
 }
 
-func (u *UHTTP) determineEncoding(r *http.Request, statusCode int) string {
-	// The go-http-client implementation decodes gzip out-of-the-box, but only if it gets 200 OK
-	// For now: use the same behavior here
-	acceptEncoding := r.Header.Get(HEADER_ACCEPT_ENCODING)
-	if statusCode == http.StatusOK {
-		if u.opts.enableBrotli && strings.Contains(acceptEncoding, ENCODING_BROTLI) {
-			return ENCODING_BROTLI
-		} else if u.opts.enableGzip && strings.Contains(acceptEncoding, ENCODING_GZIP) {
-			return ENCODING_GZIP
-		} else if u.opts.enableDeflate && strings.Contains(acceptEncoding, ENCODING_DEFLATE) {
-			return ENCODING_DEFLATE
+// acceptEncoding maps a content-coding (lowercase) to its qvalue
+type acceptEncoding map[string]float64
+
+func parseAcceptEncoding(header string) acceptEncoding {
+	accepted := acceptEncoding{}
+	for _, element := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(element, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		// equivalent according to RFC 9110
+		if coding == "x-gzip" {
+			coding = ENCODING_GZIP
 		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				// malformed elements are ignored
+				q = -1
+				break
+			}
+			q = parsed
+		}
+		if q >= 0 {
+			accepted[coding] = q
+		}
+	}
+	return accepted
+}
+
+// quality of a coding, explicit is false if it was neither listed nor matched by "*"
+func (a acceptEncoding) quality(coding string) (q float64, explicit bool) {
+	if q, ok := a[coding]; ok {
+		return q, true
+	}
+	if q, ok := a["*"]; ok {
+		return q, true
+	}
+	if coding == "identity" {
+		return 1, false
+	}
+	return 0, false
+}
+
+// addVary adds a field to the Vary header (if it is not present yet)
+func addVary(header http.Header, field string) {
+	for _, value := range header.Values(HEADER_VARY) {
+		for _, existing := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), field) {
+				return
+			}
+		}
+	}
+	header.Add(HEADER_VARY, field)
+}
+
+// setEncodingHeaders announces the chosen coding, Vary is set whenever the coding depends on the request
+func (u *UHTTP) setEncodingHeaders(w http.ResponseWriter, encoding string) {
+	if len(u.enabledEncodings()) > 0 {
+		addVary(w.Header(), HEADER_ACCEPT_ENCODING)
+	}
+	if encoding != ENCODING_PLAIN {
+		w.Header().Set(HEADER_CONTENT_ENCODING, encoding)
+	} else {
+		w.Header().Del(HEADER_CONTENT_ENCODING)
+	}
+}
+
+// writeNotAcceptable is sent if the client does not accept any coding we can produce
+func (u *UHTTP) writeNotAcceptable(w http.ResponseWriter) {
+	u.setEncodingHeaders(w, ENCODING_PLAIN)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotAcceptable)
+	if err := json.NewEncoder(w).Encode(NewHttpErrorResponse(errors.New("no acceptable content-coding"))); err != nil {
+		u.opts.logEncodingError("err writing http response (%s)", err)
 	}
-	return ENCODING_PLAIN
 }
 
+// compressJSON compresses content which is served repeatedly (persisted cache-encodings), so it uses the static levels
 func (u *UHTTP) compressJSON(encoding string, data []byte) ([]byte, error) {
 	var b bytes.Buffer
-	ew := u.encodingWriter(&b, encoding)
+	ew := getEncoder(&b, encoding, u.opts.staticCompressionLevels().level(encoding))
 	_, err := ew.Write(data)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,89 @@
+package uhttp
+
+import (
+	"io"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// all supported encoders can be reused for another destination
+type resettableEncoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+type encoderPoolKey struct {
+	encoding string
+	level    int
+}
+
+// one pool per encoding and level (encoders are expensive to allocate, especially for high levels)
+var encoderPools sync.Map
+
+// pooledEncoder returns itself to its pool when it is closed
+type pooledEncoder struct {
+	resettableEncoder
+	pool   *sync.Pool
+	closed bool
+}
+
+func (e *pooledEncoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	err := e.resettableEncoder.Close()
+	// do not keep a reference to the destination while the encoder is idle
+	e.Reset(nil)
+	e.pool.Put(e)
+	return err
+}
+
+func getEncoder(w io.Writer, encoding string, level int) io.WriteCloser {
+	if encoding == ENCODING_PLAIN {
+		return nopCloser{w}
+	}
+
+	key := encoderPoolKey{encoding: encoding, level: level}
+	pool, ok := encoderPools.Load(key)
+	if !ok {
+		pool, _ = encoderPools.LoadOrStore(key, &sync.Pool{})
+	}
+
+	if e, ok := pool.(*sync.Pool).Get().(*pooledEncoder); ok {
+		e.Reset(w)
+		e.closed = false
+		return e
+	}
+
+	encoder := newEncoder(w, encoding, level)
+	if encoder == nil {
+		return nopCloser{w}
+	}
+	return &pooledEncoder{resettableEncoder: encoder, pool: pool.(*sync.Pool)}
+}
+
+// newEncoder allocates an encoder, nil for unknown encodings
+func newEncoder(w io.Writer, encoding string, level int) resettableEncoder {
+	switch encoding {
+	case ENCODING_BROTLI:
+		return brotli.NewWriterLevel(w, level)
+	case ENCODING_GZIP:
+		// levels are clamped when assigning the options
+		encoder, _ := gzip.NewWriterLevel(w, level)
+		return encoder
+	case ENCODING_DEFLATE:
+		// levels are clamped when assigning the options
+		encoder, _ := flate.NewWriter(w, level)
+		return encoder
+	case ENCODING_ZSTD:
+		// a single response does not benefit from concurrent encoding
+		encoder, _ := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)), zstd.WithEncoderConcurrency(1))
+		return encoder
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package uhttp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// compares reusing encoders with allocating one per response
+func BenchmarkEncoderPool(b *testing.B) {
+	body := bytes.Repeat([]byte(`{"hello":"world","index":"1"},`), 100)
+	levels := defaultDynamicCompressionLevels
+	for _, encoding := range []string{ENCODING_BROTLI, ENCODING_GZIP, ENCODING_DEFLATE, ENCODING_ZSTD} {
+		for name, encoder := range map[string]func(w io.Writer) io.WriteCloser{
+			"pooled": func(w io.Writer) io.WriteCloser {
+				return getEncoder(w, encoding, levels.level(encoding))
+			},
+			"unpooled": func(w io.Writer) io.WriteCloser {
+				return newEncoder(w, encoding, levels.level(encoding))
+			},
+		} {
+			b.Run(encoding+"/"+name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					ew := encoder(io.Discard)
+					if _, err := ew.Write(body); err != nil {
+						b.Fatal(err)
+					}
+					if err := ew.Close(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package uhttp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	HEADER_ETAG              = "ETag"
+	HEADER_LAST_MODIFIED     = "Last-Modified"
+	HEADER_CACHE_CONTROL     = "Cache-Control"
+	HEADER_IF_NONE_MATCH     = "If-None-Match"
+	HEADER_IF_MODIFIED_SINCE = "If-Modified-Since"
+	HEADER_RANGE             = "Range"
+	HEADER_IF_RANGE          = "If-Range"
+)
+
+type ETagMode string
+
+const (
+	// the same ETag for all encodings of a response (default)
+	ETAG_WEAK ETagMode = "weak"
+	// a distinct ETag per encoding (byte-for-byte identical responses)
+	ETAG_STRONG   ETagMode = "strong"
+	ETAG_DISABLED ETagMode = "disabled"
+)
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:16])
+}
+
+func formatETag(hash string, mode ETagMode, encoding string) string {
+	if mode == ETAG_WEAK {
+		return `W/"` + hash + `"`
+	}
+	if encoding != ENCODING_PLAIN {
+		return `"` + hash + "-" + encoding + `"`
+	}
+	return `"` + hash + `"`
+}
+
+// notModified evaluates If-None-Match and If-Modified-Since (RFC 9110 13.1.2 and 13.1.3)
+// an empty etag or a zero lastModified are not evaluated
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get(HEADER_IF_NONE_MATCH); ifNoneMatch != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// weak comparison
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		// If-Modified-Since is ignored if If-None-Match is present
+		return false
+	}
+
+	if ifModifiedSince := r.Header.Get(HEADER_IF_MODIFIED_SINCE); ifModifiedSince != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return false
+		}
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// writeNotModified sends 304, only the validators and caching-headers are kept
+func writeNotModified(w http.ResponseWriter) {
+	w.Header().Del(HEADER_CONTENT_ENCODING)
+	w.Header().Del("Content-Type")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -1,6 +1,7 @@
 package uhttp
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"strconv"
@@ -39,41 +40,69 @@ func (u *UHTTP) RenderErrorWithStatusCode(w http.ResponseWriter, r *http.Request
 // Internal helperMethod with is used for ALL rendering throughout uhttp
 // Takes care of encoding responses
 func (u *UHTTP) rawRenderWithStatusCode(w http.ResponseWriter, r *http.Request, statusCode int, model interface{}) {
-	encoding := u.determineEncoding(r, statusCode)
-
-	// Write header
-	w.Header().Set(HEADER_CONTENT_ENCODING, encoding)
-	w.WriteHeader(statusCode)
-
-	// Prepare body-writer
-	ew := u.encodingWriter(w, encoding)
-	defer ew.Close()
+	_, ttl := getCacheDirectives(r)
+	u.renderModel(w, r, statusCode, model, time.Now(), ttl)
+}
 
-	// Write body
-	err := json.NewEncoder(ew).Encode(model)
+// renderModel renders a model which was last modified at the given time
+// maxAge overrides the maxAge of the handler's cache (if it is not 0)
+func (u *UHTTP) renderModel(w http.ResponseWriter, r *http.Request, statusCode int, model interface{}, lastModified time.Time, maxAge time.Duration) {
+	// Encode first, the validators are computed over the body and small bodies are not compressed
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(model)
+	encoding, acceptable := u.determineEncoding(r, statusCode, body.Len())
 	if err != nil {
 		u.opts.logEncodingError("err encoding http response (%s)", err)
+		u.setEncodingHeaders(w, ENCODING_PLAIN)
+		w.WriteHeader(statusCode)
 		return
 	}
 
+	u.setEncodingHeaders(w, encoding)
+
+	if !acceptable {
+		u.writeNotAcceptable(w)
+	} else if getHTTPCachingPolicy(r).apply(w, r, statusCode, encoding, bytes.TrimSuffix(body.Bytes(), []byte("\n")), lastModified, maxAge) {
+		writeNotModified(w)
+	} else {
+		// Write header
+		w.WriteHeader(statusCode)
+
+		// Write body
+		ew := getEncoder(w, encoding, u.getCompressionPolicy(r).levels.level(encoding))
+		if _, err := body.WriteTo(ew); err != nil {
+			u.opts.logEncodingError("err writing http response (%s)", err)
+		}
+		ew.Close()
+	}
+
 	// If we are in a cache-run: give the cache all info
 	if crw, ok := w.(*cachingResponseWriter); ok {
-		crw.Close(model, statusCode)
+		crw.Close(model, statusCode, lastModified)
 		return
 	}
 }
 
-func (u *UHTTP) renderCacheEntry(handler Handler, w http.ResponseWriter, r *http.Request, entry cache.CacheEntry) {
-	_ = AddLogOutput(w, "cached", "true")
-	w.Header().Add(CACHE_HEADER, "true")
+func (u *UHTTP) renderCacheEntry(handler Handler, w http.ResponseWriter, r *http.Request, entry cache.CacheEntry, indicator string) {
+	_ = AddLogOutput(w, "cached", indicator)
+	w.Header().Add(CACHE_HEADER, indicator)
 	w.Header().Add(CACHE_HEADER_AGE_HUMAN_READABLE, time.Since(entry.UpdatedOn()).String())
 	w.Header().Add(CACHE_HEADER_AGE_MS, strconv.FormatInt(time.Since(entry.UpdatedOn()).Milliseconds(), 10))
 
 	if handler.opts.cachePersistEncodings {
-		encoding := u.determineEncoding(r, entry.ResponseStatusCode())
+		encoding, acceptable := u.determineEncoding(r, entry.ResponseStatusCode(), len(entry.ResponseBodyPlain()))
+		if !acceptable {
+			u.writeNotAcceptable(w)
+			return
+		}
+		u.setEncodingHeaders(w, encoding)
 
 		// Write
-		w.Header().Set(HEADER_CONTENT_ENCODING, encoding)
+		if getHTTPCachingPolicy(r).apply(w, r, entry.ResponseStatusCode(), encoding, entry.ResponseBodyPlain(), entry.UpdatedOn(), entry.MaxAge()) {
+			writeNotModified(w)
+			return
+		}
+
 		w.WriteHeader(entry.ResponseStatusCode())
 
 		var body []byte
@@ -87,10 +116,12 @@ func (u *UHTTP) renderCacheEntry(handler Handler, w http.ResponseWriter, r *http
 			body = entry.ResponseBodyGzip()
 		case ENCODING_DEFLATE:
 			body = entry.ResponseBodyDeflate()
+		case ENCODING_ZSTD:
+			body = entry.ResponseBodyZstd()
 		}
 		_, _ = w.Write(body)
 		return
 	}
 
-	u.rawRenderWithStatusCode(w, r, entry.ResponseStatusCode(), entry.ResponseModel())
+	u.renderModel(w, r, entry.ResponseStatusCode(), entry.ResponseModel(), entry.UpdatedOn(), entry.MaxAge())
 }
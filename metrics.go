@@ -10,6 +10,7 @@ import (
 const (
 	Metric_Requests_Total    string = "uhttp_requests_total"
 	Metric_Requests_Duration string = "uhttp_requests_durations"
+	Metric_Cache_Evictions   string = "uhttp_cache_evictions"
 )
 
 func HandleMetrics(metrics map[string]interface{}, method string, status int, uri string, duration time.Duration) error {
@@ -36,3 +37,15 @@ func HandleMetrics(metrics map[string]interface{}, method string, status int, ur
 	durationMetric.Observe(float64(duration / time.Millisecond))
 	return nil
 }
+
+func HandleCacheEvictionMetrics(metrics map[string]interface{}, handler string) error {
+	counter := metrics[Metric_Cache_Evictions].(*prometheus.CounterVec)
+	counterMetric, err := counter.GetMetricWith(prometheus.Labels{
+		"handler": handler,
+	})
+	if err != nil {
+		return err
+	}
+	counterMetric.Inc()
+	return nil
+}
@@ -76,6 +76,13 @@ func (lrw *LoggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error)
 	return h.Hijack()
 }
 
+// Delegate Flush() to underlying responseWriter (e.g. for server-sent events)
+func (lrw *LoggingResponseWriter) Flush() {
+	if f, ok := lrw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // Logging log time, method and path of an HTTP-Request
 func addLoggingMiddleware(u *UHTTP, h *Handler, isStaticFileAccess bool) func(next http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
@@ -126,19 +133,6 @@ func addLoggingMiddleware(u *UHTTP, h *Handler, isStaticFileAccess bool) func(ne
 			logLineParams["method"] = r.Method
 			logLineParams["uri"] = r.URL.EscapedPath()
 
-			// Log all getParams of the request
-			if paramsRaw, ok := r.Context().Value(CtxKeyGetParams).(R); ok {
-				params, err := paramsRaw.Printable()
-				if err != nil {
-					u.opts.log.Errorf("error when trying to log %s", err)
-					u.RenderError(w, r, errors.New("internal server error"))
-					return
-				}
-				for key, value := range params {
-					logLineParams[fmt.Sprintf("urlParam-%s", key)] = value
-				}
-			}
-
 			// Were any additional params specified during the handler run?
 			if len(lrw.additionalOutput) != 0 {
 				for key, value := range lrw.additionalOutput {
@@ -162,6 +156,18 @@ func addLoggingMiddleware(u *UHTTP, h *Handler, isStaticFileAccess bool) func(ne
 	}
 }
 
+// addParamsLogOutput adds all parsed params to the access-log (prefixed e.g. urlParam-from)
+func addParamsLogOutput(u *UHTTP, w http.ResponseWriter, prefix string, params R) {
+	printable, err := params.Printable()
+	if err != nil {
+		u.opts.log.Errorf("error when trying to log %s", err)
+		return
+	}
+	for key, value := range printable {
+		_ = AddLogOutput(w, fmt.Sprintf("%s-%s", prefix, key), value)
+	}
+}
+
 func AddLogOutput(w interface{}, key, value string) error {
 	writer, ok := w.(*LoggingResponseWriter)
 	if !ok {
@@ -1,6 +1,7 @@
 package uhttp
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"net/http"
@@ -22,7 +23,7 @@ func AuthBasic(u *UHTTP, expectedUsername string, expectedHashedPasswordSha256 s
 			if err := AddLogOutput(w, "user", actualUsername); err != nil {
 				u.Log().Errorf("%s", err)
 			}
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), CtxKeyPrincipal, actualUsername)))
 		}
 	})
 }
@@ -18,6 +18,13 @@ const CACHE_HEADER = "X-UHTTP-CACHE"
 const CACHE_HEADER_AGE_HUMAN_READABLE = "X-UHTTP-CACHE-AGE-HUMAN-READABLE"
 const CACHE_HEADER_AGE_MS = "X-UHTTP-CACHE-AGE-MS"
 
+// values of CACHE_HEADER
+const (
+	CACHE_HEADER_HIT                    = "true"
+	CACHE_HEADER_STALE_WHILE_REVALIDATE = "stale-while-revalidate"
+	CACHE_HEADER_STALE_IF_ERROR         = "stale-if-error"
+)
+
 // This middleware provides a per-handler cache
 // It will cache the original response to the client based on
 // - "relevant" headers
@@ -25,19 +32,52 @@ const CACHE_HEADER_AGE_MS = "X-UHTTP-CACHE-AGE-MS"
 // - requestBody
 func cacheMiddleware(u *UHTTP, handler Handler) func(next http.HandlerFunc) http.HandlerFunc {
 	var c *cache.Cache
+	var flights *cacheFlightGroup
 
 	// only register cache once (this make the "HandlerFunc" callable more than once)
 	u.cacheLock.Lock()
 	if registeredCache, ok := u.cache[handler.opts.handlerPattern]; ok {
 		c = registeredCache
+		flights = u.cacheFlights[handler.opts.handlerPattern]
 	} else {
-		// enable wanted encodings in cache
-		c = cache.NewCache(handler.opts.cacheMaxAge, handler.opts.handlerPattern)
+		store := handler.opts.cacheStore
+		if store == nil && u.opts.cacheStore != nil {
+			store = u.opts.cacheStore(handler.opts.handlerPattern)
+		}
+		if store == nil {
+			store = cache.NewMemoryStore()
+		}
+		cacheOpts := []cache.CacheOption{
+			cache.WithErrorHandler(func(err error) {
+				u.Log().Errorf("%s", err)
+			}),
+			cache.WithBudget(handler.opts.cacheBudget),
+			cache.WithStaleRetention(max(handler.opts.cacheStaleWhileRevalidate, handler.opts.cacheStaleIfError)),
+			cache.WithEvictionHandler(func() {
+				if u.metrics != nil {
+					if err := HandleCacheEvictionMetrics(u.metrics, handler.opts.handlerPattern); err != nil {
+						u.Log().Errorf("could not update metrics (%s)", err)
+					}
+				}
+			}),
+		}
+		if u.cacheGlobalBudget != nil {
+			cacheOpts = append(cacheOpts, cache.WithGlobalBudget(u.cacheGlobalBudget))
+		}
+		if u.opts.cacheInvalidationBus != nil {
+			cacheOpts = append(cacheOpts, cache.WithInvalidationBus(u.opts.cacheInvalidationBus, u.instanceID))
+		}
+		c = cache.NewCacheWithStore(handler.opts.cacheMaxAge, handler.opts.handlerPattern, store, cacheOpts...)
 
 		if err := u.registerCache(handler.opts.handlerPattern, c); err != nil {
 			u.Log().Errorf("%s", err)
 			panic(err)
 		}
+		if u.opts.cacheSnapshotDir != "" {
+			u.restoreCacheSnapshot(handler.opts.handlerPattern, c)
+		}
+		flights = newCacheFlightGroup()
+		u.cacheFlights[handler.opts.handlerPattern] = flights
 
 		if handler.opts.cacheAutomaticUpdatesInterval > 0 {
 			// Run automatic refresher
@@ -78,31 +118,63 @@ func cacheMiddleware(u *UHTTP, handler Handler) func(next http.HandlerFunc) http
 
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			// only cache GET requests
-			if r.Method != http.MethodGet {
+			// only cache GET requests (and POST-queries if enabled)
+			if r.Method != http.MethodGet && (r.Method != http.MethodPost || !handler.opts.cachePost) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// multipart bodies (uploads) are streamed while parsing the model, they cannot be part of the key
+			if isContentType(r, CONTENT_TYPE_MULTIPART_FORM) {
 				next.ServeHTTP(w, r)
 				return
 			}
 
+			key := u.cacheKey(handler, r)
+			r = withCacheDirectives(handler, r)
+			for _, header := range handler.opts.cacheVaryHeaders() {
+				addVary(w.Header(), header)
+			}
+
 			bypassCache := r.Header.Get(handler.opts.cacheBypassHeader)
 			if bypassCache == "true" {
-				next.ServeHTTP(newCachingResponseWriter(u, handler, w, r, c), r)
+				next.ServeHTTP(newCachingResponseWriter(u, handler, w, r, c, key), r)
 				return
 			}
 
-			if entry, ok, key := c.Get(ExtractAndRestoreRequestBody(r), r.URL.RawQuery); ok {
-				if time.Since(entry.UpdatedOn()) < handler.opts.cacheMaxAge {
-					u.renderCacheEntry(handler, w, r, entry)
+			if entry, ok, hash := c.Get(key); ok {
+				age := time.Since(entry.UpdatedOn())
+				maxAge := c.EntryMaxAge(entry)
+				switch {
+				case age < maxAge:
+					u.renderCacheEntry(handler, w, r, entry, CACHE_HEADER_HIT)
+					return
+				case age < maxAge+handler.opts.cacheStaleWhileRevalidate:
+					u.renderCacheEntry(handler, w, r, entry, CACHE_HEADER_STALE_WHILE_REVALIDATE)
+					u.revalidateInBackground(handler, flights, c, key, next, r)
+					return
+				case age < maxAge+handler.opts.cacheStaleIfError:
+					u.serveStaleIfError(handler, w, r, entry, func(w http.ResponseWriter) {
+						u.serveUncached(handler, flights, c, key, next, w, r)
+					})
 					return
 				}
-				c.Delete(key)
+				c.Delete(hash)
 			}
 
-			next.ServeHTTP(newCachingResponseWriter(u, handler, w, r, c), r)
+			u.serveUncached(handler, flights, c, key, next, w, r)
 		}
 	}
 }
 
+func (u *UHTTP) serveUncached(handler Handler, flights *cacheFlightGroup, c *cache.Cache, key cache.Key, next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	if handler.opts.cacheCoalescing {
+		u.serveCoalesced(handler, flights, c, key, next, w, r)
+		return
+	}
+	next.ServeHTTP(newCachingResponseWriter(u, handler, w, r, c, key), r)
+}
+
 // a response writer whch updates the cache as soon as a response is sent to the client
 type cachingResponseWriter struct {
 	u            *UHTTP
@@ -110,12 +182,18 @@ type cachingResponseWriter struct {
 	r            *http.Request
 	w            http.ResponseWriter
 	cache        *cache.Cache
+	key          cache.Key
 	wroteHeader  bool
 	responseBody []byte
 	startTime    time.Time
+
+	// what was rendered (shared with concurrent requests which waited for this one)
+	rendered           bool
+	renderedModel      interface{}
+	renderedStatusCode int
 }
 
-func newCachingResponseWriter(u *UHTTP, h Handler, w http.ResponseWriter, r *http.Request, cache *cache.Cache) *cachingResponseWriter {
+func newCachingResponseWriter(u *UHTTP, h Handler, w http.ResponseWriter, r *http.Request, c *cache.Cache, key cache.Key) *cachingResponseWriter {
 	if u.opts.logCacheRuns {
 		if strings.Contains(r.URL.String(), NO_LOG_MAGIC_URL_FORCE_CACHE) {
 			u.Log().Infof("Started automatic caching of %s", h.opts.handlerPattern)
@@ -129,7 +207,8 @@ func newCachingResponseWriter(u *UHTTP, h Handler, w http.ResponseWriter, r *htt
 		h:         h,
 		w:         w,
 		r:         r,
-		cache:     cache,
+		cache:     c,
+		key:       key,
 		startTime: time.Now(),
 	}
 }
@@ -165,14 +244,22 @@ func (w *cachingResponseWriter) WriteHeader(code int) {
 	w.w.WriteHeader(code)
 }
 
-func (w *cachingResponseWriter) Close(model interface{}, statusCode int) {
+// Close caches the rendered model, updatedOn is the Last-Modified which was sent to the client
+func (w *cachingResponseWriter) Close(model interface{}, statusCode int, updatedOn time.Time) {
 	var err error
 	var bodyPlain []byte
 	var bodyBrotli []byte
 	var bodyGzip []byte
 	var bodyDeflate []byte
+	var bodyZstd []byte
+
+	w.rendered, w.renderedModel, w.renderedStatusCode = true, model, statusCode
 
-	if !w.h.opts.cacheFailedRequests && (statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices) {
+	if w.h.opts.cachePredicate != nil {
+		if !w.h.opts.cachePredicate(w.r, statusCode, model) {
+			return
+		}
+	} else if !w.h.opts.cacheFailedRequests && (statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices) {
 		return
 	}
 
@@ -199,13 +286,26 @@ func (w *cachingResponseWriter) Close(model interface{}, statusCode int) {
 					w.u.Log().Errorf("could not compress JSON for caching (%s)", err)
 				}
 			}
+			if w.u.opts.enableZstd {
+				bodyZstd, err = w.u.compressJSON(ENCODING_ZSTD, bodyPlain)
+				if err != nil {
+					w.u.Log().Errorf("could not compress JSON for caching (%s)", err)
+				}
+			}
 		}
 	}
 
+	// validators, Cache-Control and the coding are computed for every response
+	responseHeader := w.w.Header().Clone()
+	for _, header := range []string{HEADER_ETAG, HEADER_LAST_MODIFIED, HEADER_CACHE_CONTROL, HEADER_CONTENT_ENCODING} {
+		responseHeader.Del(header)
+	}
+
+	tags, ttl := getCacheDirectives(w.r)
 	w.cache.Set(
-		ExtractAndRestoreRequestBody(w.r), w.r.URL.RawQuery, w.r.Header.Clone(),
-		model, w.w.Header().Clone(), statusCode,
-		bodyPlain, bodyBrotli, bodyGzip, bodyDeflate,
+		w.key, updatedOn, ttl, w.r.Header.Clone(), tags,
+		model, responseHeader, statusCode,
+		bodyPlain, bodyBrotli, bodyGzip, bodyDeflate, bodyZstd,
 	)
 
 	if w.u.opts.logCacheRuns {
@@ -0,0 +1,124 @@
+package uhttp
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dunv/uhttp/cache"
+)
+
+// a single execution of a handler for a cache-key, concurrent requests for the same key wait for it
+type cacheFlight struct {
+	done chan struct{}
+
+	// result of the execution (only valid after done is closed)
+	rendered   bool
+	model      interface{}
+	statusCode int
+	panicked   interface{}
+}
+
+type cacheFlightGroup struct {
+	mu      *sync.Mutex
+	flights map[string]*cacheFlight
+}
+
+func newCacheFlightGroup() *cacheFlightGroup {
+	return &cacheFlightGroup{
+		mu:      &sync.Mutex{},
+		flights: map[string]*cacheFlight{},
+	}
+}
+
+// join returns the running flight for the key or starts a new one (leader is true in that case)
+func (g *cacheFlightGroup) join(key string) (*cacheFlight, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if flight, ok := g.flights[key]; ok {
+		return flight, false
+	}
+	flight := &cacheFlight{done: make(chan struct{})}
+	g.flights[key] = flight
+	return flight, true
+}
+
+// lead executes the handler and shares its result with all waiters
+// a panic is handed to all waiters and afterwards re-panicked
+func (g *cacheFlightGroup) lead(key string, flight *cacheFlight, execute func() *cachingResponseWriter) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			flight.panicked = rec
+			g.finish(key, flight)
+			panic(rec)
+		}
+	}()
+
+	crw := execute()
+	flight.rendered, flight.model, flight.statusCode = crw.rendered, crw.renderedModel, crw.renderedStatusCode
+	g.finish(key, flight)
+}
+
+func (g *cacheFlightGroup) finish(key string, flight *cacheFlight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.flights, key)
+	close(flight.done)
+}
+
+// serveCoalesced collapses concurrent cache-misses of the same key into a single execution of the handler
+func (u *UHTTP) serveCoalesced(handler Handler, flights *cacheFlightGroup, c *cache.Cache, key cache.Key, next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	flight, leader := flights.join(key.Hash())
+	if leader {
+		flights.lead(key.Hash(), flight, func() *cachingResponseWriter {
+			crw := newCachingResponseWriter(u, handler, w, r, c, key)
+			next.ServeHTTP(crw, r)
+			return crw
+		})
+		return
+	}
+
+	var timeout <-chan time.Time
+	if handler.opts.cacheCoalescingTimeout > 0 {
+		timer := time.NewTimer(handler.opts.cacheCoalescingTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-flight.done:
+	case <-timeout:
+		u.Log().Infof("waiting for running execution of %s timed out, executing again", handler.opts.handlerPattern)
+		next.ServeHTTP(newCachingResponseWriter(u, handler, w, r, c, key), r)
+		return
+	case <-r.Context().Done():
+		return
+	}
+
+	_ = AddLogOutput(w, "coalesced", "true")
+
+	if flight.panicked != nil {
+		err := fmt.Errorf("internal server error")
+		if u.opts.sendPanicInfoToClient {
+			err = fmt.Errorf("panic: handlerExecution (%s)", flight.panicked)
+		}
+		u.RenderErrorWithStatusCode(w, r, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	// the handler did not use uhttp's rendering, there is nothing which can be shared
+	if !flight.rendered {
+		next.ServeHTTP(newCachingResponseWriter(u, handler, w, r, c, key), r)
+		return
+	}
+
+	// the entry can still be a stale one, if the execution failed
+	if entry, ok, _ := c.Get(key); ok && time.Since(entry.UpdatedOn()) < c.EntryMaxAge(entry) {
+		u.renderCacheEntry(handler, w, r, entry, CACHE_HEADER_HIT)
+		return
+	}
+
+	// not cached (e.g. failed requests), render the same result again (with this request's encoding)
+	u.rawRenderWithStatusCode(w, r, flight.statusCode, flight.model)
+}
@@ -0,0 +1,91 @@
+package uhttp
+
+import (
+	"net/http"
+
+	"github.com/dunv/uhttp/cache"
+)
+
+// headers which carry credentials, they are part of the cache-key unless WithCacheKeyIgnoreCredentials is used
+// the Cookie-header is not (unrelated cookies would split the cache per client), cookies which carry
+// credentials need to be declared with WithCacheKeyCookies (or use WithCacheKeyPrincipal)
+var cacheCredentialHeaders = []string{"Authorization"}
+
+// cacheKeyHeaders are the configured headers and the credentials
+func (o handlerOptions) cacheKeyHeaderNames() []string {
+	if o.cacheKeyIgnoreCredentials {
+		return o.cacheKeyHeaders
+	}
+	return append(append([]string{}, o.cacheKeyHeaders...), cacheCredentialHeaders...)
+}
+
+// cacheVaryHeaders are the headers the cached responses depend on
+func (o handlerOptions) cacheVaryHeaders() []string {
+	headers := o.cacheKeyHeaderNames()
+	if len(o.cacheKeyCookies) != 0 {
+		headers = append(append([]string{}, headers...), "Cookie")
+	}
+	return headers
+}
+
+// cacheKeyedBy describes what the cache-key of a handler is built from (for the cache-details)
+func (o handlerOptions) cacheKeyedBy() []string {
+	keyedBy := []string{"params"}
+	for _, header := range o.cacheKeyHeaderNames() {
+		keyedBy = append(keyedBy, "header:"+http.CanonicalHeaderKey(header))
+	}
+	for _, cookie := range o.cacheKeyCookies {
+		keyedBy = append(keyedBy, "cookie:"+cookie)
+	}
+	if o.cacheKeyPrincipal {
+		keyedBy = append(keyedBy, "principal")
+	}
+	if o.cacheKeyFunc != nil {
+		keyedBy = append(keyedBy, "custom")
+	}
+	return keyedBy
+}
+
+// cacheKey collects everything the response of a request depends on (see WithCacheKey* options)
+func (u *UHTTP) cacheKey(handler Handler, r *http.Request) cache.Key {
+	key := cache.Key{
+		Params:  r.URL.Query(),
+		Body:    ExtractAndRestoreRequestBody(r),
+		KeyedBy: handler.opts.cacheKeyedBy(),
+	}
+	if r.Method != http.MethodGet {
+		key.Method = r.Method
+	}
+
+	for _, param := range handler.opts.cacheKeyIgnoredParams {
+		key.Params.Del(param)
+	}
+
+	for _, header := range handler.opts.cacheKeyHeaderNames() {
+		if values := r.Header.Values(header); len(values) != 0 {
+			if key.Headers == nil {
+				key.Headers = http.Header{}
+			}
+			key.Headers[http.CanonicalHeaderKey(header)] = values
+		}
+	}
+
+	for _, name := range handler.opts.cacheKeyCookies {
+		if cookie, err := r.Cookie(name); err == nil {
+			if key.Cookies == nil {
+				key.Cookies = map[string]string{}
+			}
+			key.Cookies[name] = cookie.Value
+		}
+	}
+
+	if handler.opts.cacheKeyPrincipal {
+		key.Principal = GetPrincipal(r)
+	}
+
+	if handler.opts.cacheKeyFunc != nil {
+		key.Custom = handler.opts.cacheKeyFunc(r)
+	}
+
+	return key
+}
@@ -0,0 +1,102 @@
+package uhttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/dunv/uhttp/cache"
+)
+
+// revalidateInBackground refreshes an entry without blocking the request (only once at a time per key)
+func (u *UHTTP) revalidateInBackground(handler Handler, flights *cacheFlightGroup, c *cache.Cache, key cache.Key, next http.HandlerFunc, r *http.Request) {
+	flight, leader := flights.join(key.Hash())
+	if !leader {
+		return
+	}
+
+	// the refresh must outlive the request which triggered it
+	backgroundRequest := withCacheDirectives(handler, r.Clone(context.WithoutCancel(r.Context())))
+	backgroundRequest.Body = io.NopCloser(bytes.NewReader(ExtractAndRestoreRequestBody(r)))
+
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				u.Log().Errorf("panic while revalidating cache of %s (%v)", handler.opts.handlerPattern, rec)
+			}
+		}()
+		flights.lead(key.Hash(), flight, func() *cachingResponseWriter {
+			noopWriter := &noopResponseWriter{}
+			crw := newCachingResponseWriter(u, handler, noopWriter, backgroundRequest, c, key)
+			next.ServeHTTP(crw, backgroundRequest)
+			if noopWriter.statusCode >= http.StatusInternalServerError {
+				u.Log().Errorf("could not revalidate cache of %s. statusCode:%d", handler.opts.handlerPattern, noopWriter.statusCode)
+			}
+			return crw
+		})
+	}()
+}
+
+// serveStaleIfError buffers the response of serve and serves the stale entry instead if it failed
+func (u *UHTTP) serveStaleIfError(handler Handler, w http.ResponseWriter, r *http.Request, stale cache.CacheEntry, serve func(w http.ResponseWriter)) {
+	buffer := newBufferingResponseWriter()
+
+	panicked := func() (panicked bool) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				u.Log().Errorf("panic [path: %s] serving stale cache-entry instead (%v)", r.RequestURI, rec)
+				panicked = true
+			}
+		}()
+		serve(buffer)
+		return false
+	}()
+
+	if panicked || buffer.statusCode >= http.StatusInternalServerError {
+		u.renderCacheEntry(handler, w, r, stale, CACHE_HEADER_STALE_IF_ERROR)
+		return
+	}
+	buffer.flush(w)
+}
+
+// a response writer which keeps everything in memory until it is flushed
+type bufferingResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       *bytes.Buffer
+}
+
+func newBufferingResponseWriter() *bufferingResponseWriter {
+	return &bufferingResponseWriter{
+		header: http.Header{},
+		body:   &bytes.Buffer{},
+	}
+}
+
+func (w *bufferingResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferingResponseWriter) Write(data []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+func (w *bufferingResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *bufferingResponseWriter) flush(target http.ResponseWriter) {
+	for key, values := range w.header {
+		target.Header()[key] = values
+	}
+	if w.statusCode != 0 {
+		target.WriteHeader(w.statusCode)
+	}
+	_, _ = target.Write(w.body.Bytes())
+}
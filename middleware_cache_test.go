@@ -1,14 +1,26 @@
 package uhttp_test
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/dunv/uhttp"
+	"github.com/dunv/uhttp/cache"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -215,36 +227,36 @@ func TestExposeCacheManagement(t *testing.T) {
 	u.Handle("/cache2", handler2)
 
 	// check initial size
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 0, "sizeInBytes": 0}, "/cache2": {"entries": 0, "sizeInBytes": 0}, "total": {"entries": 0, "sizeInBytes": 0}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 0, "evictions": 0, "sizeInBytes": 0}, "/cache2": {"entries": 0, "evictions": 0, "sizeInBytes": 0}, "total": {"entries": 0, "evictions": 0, "sizeInBytes": 0}}`)
 
 	// populate first
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/cache1", nil, `{"all1": "ok"}`)
 
 	// check result
 	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details", nil)
-	require.Contains(t, body, `{"/cache1":{"3333366435656263353433363533346536316431366536336464666361333237":"{ updated:`)
+	require.Contains(t, body, `{"/cache1":{"3264666533323664616430646634373137613733353962353663383966393432":"{ updated:`)
 	require.Contains(t, body, `statusCode:200 model:true bodyPlain:false bodyBr:false bodyGzip:false bodyDeflate:false }"},"/cache2":{}}`)
 
 	// check result
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 1, "sizeInBytes": 16}, "/cache2": {"entries": 0, "sizeInBytes": 0},  "total": {"entries": 1, "sizeInBytes": 16}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 1, "evictions": 0, "sizeInBytes": 101}, "/cache2": {"entries": 0, "evictions": 0, "sizeInBytes": 0},  "total": {"entries": 1, "evictions": 0, "sizeInBytes": 101}}`)
 
 	// populate second
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/cache2", nil, fmt.Sprintf(`{"longerResponse": "%s"}`, longResponse))
 
 	// check result
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 1, "sizeInBytes": 16}, "/cache2": {"entries": 1, "sizeInBytes": 16},  "total": {"entries": 2, "sizeInBytes": 32}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 1, "evictions": 0, "sizeInBytes": 101}, "/cache2": {"entries": 1, "evictions": 0, "sizeInBytes": 100109},  "total": {"entries": 2, "evictions": 0, "sizeInBytes": 100210}}`)
 
 	// clear first
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodPost, "/uhttp/cache/clear", map[string][]string{"path": {"/cache1"}}, `{"deletedEntries": 1}`)
 
 	// check result
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 0, "sizeInBytes": 0}, "/cache2": {"entries": 1, "sizeInBytes": 16},  "total": {"entries": 1, "sizeInBytes": 16}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 0, "evictions": 0, "sizeInBytes": 0}, "/cache2": {"entries": 1, "evictions": 0, "sizeInBytes": 100109},  "total": {"entries": 1, "evictions": 0, "sizeInBytes": 100109}}`)
 
 	// clear second
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodPost, "/uhttp/cache/clear", map[string][]string{"path": {"/cache2"}}, `{"deletedEntries": 1}`)
 
 	// check result
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 0, "sizeInBytes": 0}, "/cache2": {"entries": 0, "sizeInBytes": 0}, "total": {"entries": 0, "sizeInBytes": 0}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 0, "evictions": 0, "sizeInBytes": 0}, "/cache2": {"entries": 0, "evictions": 0, "sizeInBytes": 0}, "total": {"entries": 0, "evictions": 0, "sizeInBytes": 0}}`)
 
 	// populate first
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/cache1", nil, `{"all1": "ok"}`)
@@ -253,13 +265,13 @@ func TestExposeCacheManagement(t *testing.T) {
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/cache2", nil, fmt.Sprintf(`{"longerResponse": "%s"}`, longResponse))
 
 	// check result
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 1, "sizeInBytes": 16}, "/cache2": {"entries": 1, "sizeInBytes": 16},  "total": {"entries": 2, "sizeInBytes": 32}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 1, "evictions": 0, "sizeInBytes": 101}, "/cache2": {"entries": 1, "evictions": 0, "sizeInBytes": 100109},  "total": {"entries": 2, "evictions": 0, "sizeInBytes": 100210}}`)
 
 	// clear all
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodPost, "/uhttp/cache/clear", nil, `{"deletedEntries": 2}`)
 
 	// check result
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 0, "sizeInBytes": 0}, "/cache2": {"entries": 0, "sizeInBytes": 0}, "total": {"entries": 0, "sizeInBytes": 0}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache1": {"entries": 0, "evictions": 0, "sizeInBytes": 0}, "/cache2": {"entries": 0, "evictions": 0, "sizeInBytes": 0}, "total": {"entries": 0, "evictions": 0, "sizeInBytes": 0}}`)
 }
 
 func TestCacheEncodings(t *testing.T) {
@@ -277,14 +289,14 @@ func TestCacheEncodings(t *testing.T) {
 	u.Handle("/cache", handler)
 
 	// check initial size
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache": {"entries": 0, "sizeInBytes": 0}, "total": {"entries": 0, "sizeInBytes": 0}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache": {"entries": 0, "evictions": 0, "sizeInBytes": 0}, "total": {"entries": 0, "evictions": 0, "sizeInBytes": 0}}`)
 
 	// populate first
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/cache", nil, `{"all": "ok"}`)
 
 	// check result
 	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details", nil)
-	require.Contains(t, body, `{"/cache":{"3333366435656263353433363533346536316431366536336464666361333237":"{ updated:`)
+	require.Contains(t, body, `{"/cache":{"3264666533323664616430646634373137613733353962353663383966393432":"{ updated:`)
 	require.Contains(t, body, `statusCode:200 model:true bodyPlain:true bodyBr:true bodyGzip:true bodyDeflate:true }"}}`)
 }
 
@@ -303,14 +315,14 @@ func TestCacheEncodingsNoBrotli(t *testing.T) {
 	u.Handle("/cache", handler)
 
 	// check initial size
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache": {"entries": 0, "sizeInBytes": 0}, "total": {"entries": 0, "sizeInBytes": 0}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache": {"entries": 0, "evictions": 0, "sizeInBytes": 0}, "total": {"entries": 0, "evictions": 0, "sizeInBytes": 0}}`)
 
 	// populate first
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/cache", nil, `{"all": "ok"}`)
 
 	// check result
 	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details", nil)
-	require.Contains(t, body, `{"/cache":{"3333366435656263353433363533346536316431366536336464666361333237":"{ updated:`)
+	require.Contains(t, body, `{"/cache":{"3264666533323664616430646634373137613733353962353663383966393432":"{ updated:`)
 	require.Contains(t, body, `statusCode:200 model:true bodyPlain:true bodyBr:false bodyGzip:true bodyDeflate:true }"}}`)
 }
 
@@ -329,14 +341,14 @@ func TestCacheEncodingsNoGzip(t *testing.T) {
 	u.Handle("/cache", handler)
 
 	// check initial size
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache": {"entries": 0, "sizeInBytes": 0}, "total": {"entries": 0, "sizeInBytes": 0}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache": {"entries": 0, "evictions": 0, "sizeInBytes": 0}, "total": {"entries": 0, "evictions": 0, "sizeInBytes": 0}}`)
 
 	// populate first
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/cache", nil, `{"all": "ok"}`)
 
 	// check result
 	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details", nil)
-	require.Contains(t, body, `{"/cache":{"3333366435656263353433363533346536316431366536336464666361333237":"{ updated:`)
+	require.Contains(t, body, `{"/cache":{"3264666533323664616430646634373137613733353962353663383966393432":"{ updated:`)
 	require.Contains(t, body, `statusCode:200 model:true bodyPlain:true bodyBr:true bodyGzip:false bodyDeflate:true }"}}`)
 }
 
@@ -355,14 +367,14 @@ func TestCacheEncodingsNoDeflate(t *testing.T) {
 	u.Handle("/cache", handler)
 
 	// check initial size
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache": {"entries": 0, "sizeInBytes": 0}, "total": {"entries": 0, "sizeInBytes": 0}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache": {"entries": 0, "evictions": 0, "sizeInBytes": 0}, "total": {"entries": 0, "evictions": 0, "sizeInBytes": 0}}`)
 
 	// populate first
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/cache", nil, `{"all": "ok"}`)
 
 	// check result
 	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details", nil)
-	require.Contains(t, body, `{"/cache":{"3333366435656263353433363533346536316431366536336464666361333237":"{ updated:`)
+	require.Contains(t, body, `{"/cache":{"3264666533323664616430646634373137613733353962353663383966393432":"{ updated:`)
 	require.Contains(t, body, `statusCode:200 model:true bodyPlain:true bodyBr:true bodyGzip:true bodyDeflate:false }"}}`)
 }
 
@@ -380,14 +392,14 @@ func TestCacheNoEncodings(t *testing.T) {
 	u.Handle("/cache", handler)
 
 	// check initial size
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache": {"entries": 0, "sizeInBytes": 0}, "total": {"entries": 0, "sizeInBytes": 0}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil, `{"/cache": {"entries": 0, "evictions": 0, "sizeInBytes": 0}, "total": {"entries": 0, "evictions": 0, "sizeInBytes": 0}}`)
 
 	// populate first
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/cache", nil, `{"all": "ok"}`)
 
 	// check result
 	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details", nil)
-	require.Contains(t, body, `{"/cache":{"3333366435656263353433363533346536316431366536336464666361333237":"{ updated:`)
+	require.Contains(t, body, `{"/cache":{"3264666533323664616430646634373137613733353962353663383966393432":"{ updated:`)
 	require.Contains(t, body, `statusCode:200 model:true bodyPlain:false bodyBr:false bodyGzip:false bodyDeflate:false }"}}`)
 }
 
@@ -420,7 +432,7 @@ func TestExposeCacheManagementMiddleware(t *testing.T) {
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodPost, "/uhttp/cache/clear", nil, `{"err": "forbidden"}`)
 
 	// working
-	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size?testMiddleware", nil, `{"/cache": {"entries": 0, "sizeInBytes": 0},  "total": {"entries": 0, "sizeInBytes": 0}}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size?testMiddleware", nil, `{"/cache": {"entries": 0, "evictions": 0, "sizeInBytes": 0},  "total": {"entries": 0, "evictions": 0, "sizeInBytes": 0}}`)
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details?testMiddleware", nil, `{"/cache": {}}`)
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodPost, "/uhttp/cache/clear?testMiddleware", nil, `{"deletedEntries": 0}`)
 	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodPost, "/uhttp/cache/clear?path=cache&testMiddleware", nil, `{"deletedEntries": 0}`)
@@ -543,6 +555,7 @@ func setupCacheEncodingTest(_ *testing.T) *uhttp.UHTTP {
 	handler := uhttp.NewHandler(
 		uhttp.WithCache(10*time.Second),
 		uhttp.WithCachePersistEncodings(),
+		uhttp.WithCompressionMinSize(0),
 		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
 			counter++
 			return map[string]int{"counter": counter}
@@ -593,3 +606,1048 @@ func TestCachePersistedEncodingDeflate(t *testing.T) {
 	require.Equal(t, "deflate", res.Header.Get("Content-Encoding"))
 	require.JSONEq(t, `{"counter": 1}`, string(body))
 }
+
+func TestCacheSharedStore(t *testing.T) {
+	backend := cache.NewMemoryBytesStore()
+
+	counter := 0
+	newReplica := func() *uhttp.UHTTP {
+		u := uhttp.NewUHTTP(uhttp.WithDefaultCacheStore(func(handlerPattern string) cache.Store {
+			return cache.NewSerializedStore(backend, handlerPattern)
+		}))
+		u.Handle("/test", uhttp.NewHandler(
+			uhttp.WithCache(10*time.Second),
+			uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+				counter++
+				return map[string]int{"counter": counter}
+			}),
+		))
+		u.ExposeCacheHandlers()
+		return u
+	}
+	replica1 := newReplica()
+	replica2 := newReplica()
+
+	RequireHTTPBodyAndNotHeader(t, replica1.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"counter": 1}`, []string{uhttp.CACHE_HEADER})
+	RequireHTTPBodyAndHeader(t, replica2.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"counter": 1}`, map[string][]string{uhttp.CACHE_HEADER: {"true"}})
+	RequireHTTPBodyAndHeader(t, replica1.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"counter": 1}`, map[string][]string{uhttp.CACHE_HEADER: {"true"}})
+
+	// clearing on one replica clears all of them
+	RequireHTTPBodyJSONEq(t, replica1.ServeMux().ServeHTTP, http.MethodPost, "/uhttp/cache/clear", nil, `{"deletedEntries": 1}`)
+	RequireHTTPBodyAndNotHeader(t, replica2.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"counter": 2}`, []string{uhttp.CACHE_HEADER})
+}
+
+func TestCacheSerializedStoreEncodings(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	counter := 0
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithCachePersistEncodings(),
+		uhttp.WithCacheStore(cache.NewSerializedStore(cache.NewMemoryBytesStore(), "/test")),
+		uhttp.WithCompressionMinSize(0),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			counter++
+			return map[string]int{"counter": counter}
+		}),
+	))
+
+	for i := 0; i < 2; i++ {
+		_, _, _, res := Run(t, u, http.MethodGet, "/test", map[string]string{"Accept-Encoding": "gzip"})
+		body, err := uhttp.DecodeResponseBody(res)
+		require.NoError(t, err)
+		require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+		require.JSONEq(t, `{"counter": 1}`, string(body))
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Get(string) (cache.CacheEntry, bool, error) {
+	return cache.CacheEntry{}, false, errors.New("unavailable")
+}
+func (failingStore) Set(string, cache.CacheEntry, time.Duration) error {
+	return errors.New("unavailable")
+}
+func (failingStore) Delete(string) error     { return errors.New("unavailable") }
+func (failingStore) Keys() ([]string, error) { return nil, errors.New("unavailable") }
+func (failingStore) Size() (uint64, error)   { return 0, errors.New("unavailable") }
+func (failingStore) Count() (int, error)     { return 0, errors.New("unavailable") }
+
+func TestCacheStoreErrors(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	counter := 0
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithCacheStore(failingStore{}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			counter++
+			return map[string]int{"counter": counter}
+		}),
+	))
+
+	// an unavailable store behaves like an empty cache
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"counter": 1}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"counter": 2}`)
+}
+
+func setupCacheBudgetTest(t *testing.T, u *uhttp.UHTTP, pattern string, opts ...uhttp.HandlerOption) *int {
+	counter := 0
+	u.Handle(pattern, uhttp.NewHandler(append(opts,
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithOptionalGet(uhttp.R{"id": uhttp.STRING}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			counter++
+			return map[string]interface{}{"id": uhttp.GetAsString("id", r), "counter": counter}
+		}),
+	)...))
+	return &counter
+}
+
+func requireCached(t *testing.T, u *uhttp.UHTTP, url string, cached bool) {
+	_, _, header, _ := Run(t, u, http.MethodGet, url, nil)
+	if cached {
+		require.Equal(t, "true", header.Get(uhttp.CACHE_HEADER), url)
+	} else {
+		require.Empty(t, header.Get(uhttp.CACHE_HEADER), url)
+	}
+}
+
+func TestCacheBudgetLRU(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.ExposeCacheHandlers()
+	setupCacheBudgetTest(t, u, "/test", uhttp.WithCacheBudget(0, 2, cache.EVICTION_LRU))
+
+	requireCached(t, u, "/test?id=1", false)
+	requireCached(t, u, "/test?id=2", false)
+	requireCached(t, u, "/test?id=1", true)
+
+	// 2 is the least recently used
+	requireCached(t, u, "/test?id=3", false)
+	requireCached(t, u, "/test?id=1", true)
+	requireCached(t, u, "/test?id=3", true)
+	requireCached(t, u, "/test?id=2", false)
+
+	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil)
+	require.Contains(t, body, `"/test":{"entries":2,"evictions":2`)
+}
+
+func TestCacheBudgetLFU(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	setupCacheBudgetTest(t, u, "/test", uhttp.WithCacheBudget(0, 2, cache.EVICTION_LFU))
+
+	requireCached(t, u, "/test?id=1", false)
+	requireCached(t, u, "/test?id=1", true)
+	requireCached(t, u, "/test?id=1", true)
+	requireCached(t, u, "/test?id=2", false)
+	requireCached(t, u, "/test?id=2", true)
+
+	// 2 is used less frequently than 1 (although it was used more recently)
+	requireCached(t, u, "/test?id=3", false)
+	requireCached(t, u, "/test?id=1", true)
+	requireCached(t, u, "/test?id=2", false)
+}
+
+func TestCacheBudgetBytes(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.ExposeCacheHandlers()
+	setupCacheBudgetTest(t, u, "/test", uhttp.WithCacheBudget(250, 0, cache.EVICTION_LRU))
+
+	for i := 0; i < 10; i++ {
+		requireCached(t, u, fmt.Sprintf("/test?id=%d", i), false)
+	}
+
+	var size map[string]map[string]uint64
+	require.NoError(t, json.Unmarshal([]byte(assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil)), &size))
+	require.LessOrEqual(t, size["/test"]["sizeInBytes"], uint64(250))
+	require.Greater(t, size["/test"]["entries"], uint64(0))
+	require.Equal(t, uint64(10), size["/test"]["entries"]+size["/test"]["evictions"])
+
+	// the most recent entry survives
+	requireCached(t, u, "/test?id=9", true)
+}
+
+func TestCacheBudgetIgnoresEntriesExpiredByTheStore(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.ExposeCacheHandlers()
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(50*time.Millisecond),
+		uhttp.WithCacheStore(cache.NewSerializedStore(cache.NewMemoryBytesStore(), "/test")),
+		uhttp.WithCacheBudget(0, 2, cache.EVICTION_LRU),
+		uhttp.WithOptionalGet(uhttp.R{"id": uhttp.STRING}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]interface{}{"id": uhttp.GetAsString("id", r)}
+		}),
+	))
+
+	requireCached(t, u, "/test?id=1", false)
+	requireCached(t, u, "/test?id=2", false)
+
+	// both entries expire in the store, they must not count against the budget anymore
+	time.Sleep(100 * time.Millisecond)
+	requireCached(t, u, "/test?id=3", false)
+	requireCached(t, u, "/test?id=4", false)
+
+	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil)
+	require.Contains(t, body, `"/test":{"entries":2,"evictions":0`)
+}
+
+func BenchmarkCacheBudgetEviction(b *testing.B) {
+	for _, policy := range []cache.EvictionPolicy{cache.EVICTION_LRU, cache.EVICTION_LFU} {
+		b.Run(string(policy), func(b *testing.B) {
+			// every Set beyond the first 10000 evicts an entry
+			c := cache.NewCacheWithStore(time.Minute, "/test", cache.NewMemoryStore(), cache.WithBudget(cache.Budget{MaxEntries: 10000, Policy: policy}))
+			body := []byte(`{}`)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := cache.Key{Params: url.Values{"id": {strconv.Itoa(i)}}}
+				c.Set(key, time.Now(), 0, nil, nil, nil, nil, http.StatusOK, body, nil, nil, nil, nil)
+			}
+		})
+	}
+}
+
+func TestCacheGlobalBudget(t *testing.T) {
+	u := uhttp.NewUHTTP(uhttp.WithGlobalCacheBudget(0, 2, cache.EVICTION_LRU))
+	u.ExposeCacheHandlers()
+	setupCacheBudgetTest(t, u, "/test1")
+	setupCacheBudgetTest(t, u, "/test2")
+
+	requireCached(t, u, "/test1?id=1", false)
+	requireCached(t, u, "/test2?id=1", false)
+	requireCached(t, u, "/test1?id=1", true)
+
+	// the entry of /test2 is the least recently used across all caches
+	requireCached(t, u, "/test1?id=2", false)
+	requireCached(t, u, "/test1?id=1", true)
+	requireCached(t, u, "/test1?id=2", true)
+	requireCached(t, u, "/test2?id=1", false)
+
+	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil)
+	require.Contains(t, body, `"total":{"entries":2,"evictions":2`)
+}
+
+// runs requests concurrently while the first execution of the handler is blocked
+func runCoalescedRequests(t *testing.T, handler http.Handler, requests int, started <-chan struct{}, release chan<- struct{}) []*httptest.ResponseRecorder {
+	recorders := make([]*httptest.ResponseRecorder, requests)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < requests; i++ {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer wg.Done()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+		}(recorders[i])
+		if i == 0 {
+			<-started
+		}
+	}
+	// give all requests the chance to join the running execution
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	return recorders
+}
+
+func TestCacheCoalescing(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	executions := atomic.Int32{}
+	started, release := make(chan struct{}), make(chan struct{})
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			if executions.Add(1) == 1 {
+				close(started)
+			}
+			<-release
+			return map[string]int{"executions": int(executions.Load())}
+		}),
+	))
+
+	for _, w := range runCoalescedRequests(t, u.ServeMux(), 10, started, release) {
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"executions": 1}`, w.Body.String())
+	}
+	require.Equal(t, int32(1), executions.Load())
+}
+
+func TestCacheCoalescingErrors(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	executions := atomic.Int32{}
+	started, release := make(chan struct{}), make(chan struct{})
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			if executions.Add(1) == 1 {
+				close(started)
+			}
+			<-release
+			*ret = http.StatusServiceUnavailable
+			return fmt.Errorf("execution %d failed", executions.Load())
+		}),
+	))
+
+	for _, w := range runCoalescedRequests(t, u.ServeMux(), 10, started, release) {
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+		require.JSONEq(t, `{"error": "execution 1 failed"}`, w.Body.String())
+	}
+	require.Equal(t, int32(1), executions.Load())
+
+	// failed requests are not cached
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"error": "execution 2 failed"}`)
+}
+
+type panickingModel struct{}
+
+func (panickingModel) MarshalJSON() ([]byte, error) {
+	panic("cannot marshal")
+}
+
+func TestCacheCoalescingPanic(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	executions := atomic.Int32{}
+	started, release := make(chan struct{}), make(chan struct{})
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			if executions.Add(1) == 1 {
+				close(started)
+			}
+			<-release
+			return panickingModel{}
+		}),
+	))
+
+	// the panic of the leading request is re-panicked (usually net/http handles it)
+	panics := atomic.Int32{}
+	leader := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				panics.Add(1)
+			}
+		}()
+		u.ServeMux().ServeHTTP(w, r)
+	})
+
+	failed := 0
+	for _, w := range runCoalescedRequests(t, leader, 5, started, release) {
+		if w.Code == http.StatusInternalServerError {
+			require.JSONEq(t, `{"error": "internal server error"}`, w.Body.String())
+			failed++
+		}
+	}
+	require.Equal(t, int32(1), panics.Load())
+	require.Equal(t, 4, failed)
+	require.Equal(t, int32(1), executions.Load())
+}
+
+func TestCacheCoalescingTimeout(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	executions := atomic.Int32{}
+	started, release := make(chan struct{}), make(chan struct{})
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithCacheCoalescing(true, 10*time.Millisecond),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			// only the first execution is slow
+			if executions.Add(1) == 1 {
+				close(started)
+				<-release
+				return map[string]string{"execution": "slow"}
+			}
+			return map[string]string{"execution": "fast"}
+		}),
+	))
+
+	recorders := runCoalescedRequests(t, u.ServeMux(), 2, started, release)
+	require.JSONEq(t, `{"execution": "slow"}`, recorders[0].Body.String())
+	require.JSONEq(t, `{"execution": "fast"}`, recorders[1].Body.String())
+	require.Equal(t, int32(2), executions.Load())
+}
+
+func TestCacheCoalescingDisabled(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	executions := atomic.Int32{}
+	started, release := make(chan struct{}), make(chan struct{})
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithCacheCoalescing(false, 0),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			if executions.Add(1) == 1 {
+				close(started)
+			}
+			<-release
+			return map[string]string{}
+		}),
+	))
+
+	runCoalescedRequests(t, u.ServeMux(), 3, started, release)
+	require.Equal(t, int32(3), executions.Load())
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	executions := atomic.Int32{}
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(50*time.Millisecond),
+		uhttp.WithCacheStaleWhileRevalidate(100*time.Millisecond),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]int32{"executions": executions.Add(1)}
+		}),
+	))
+
+	RequireHTTPBodyAndNotHeader(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"executions": 1}`, []string{uhttp.CACHE_HEADER})
+	time.Sleep(60 * time.Millisecond)
+
+	// stale entry is served immediately, the refresh runs in the background
+	RequireHTTPBodyAndHeader(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"executions": 1}`, map[string][]string{uhttp.CACHE_HEADER: {uhttp.CACHE_HEADER_STALE_WHILE_REVALIDATE}})
+	require.Eventually(t, func() bool { return executions.Load() == 2 }, time.Second, 5*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil) == "{\"executions\":2}\n"
+	}, time.Second, 5*time.Millisecond)
+	RequireHTTPBodyAndHeader(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"executions": 2}`, map[string][]string{uhttp.CACHE_HEADER: {uhttp.CACHE_HEADER_HIT}})
+
+	// entries are removed after maxAge + staleWhileRevalidate
+	time.Sleep(160 * time.Millisecond)
+	RequireHTTPBodyAndNotHeader(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"executions": 3}`, []string{uhttp.CACHE_HEADER})
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	executions := atomic.Int32{}
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(50*time.Millisecond),
+		uhttp.WithCacheStaleIfError(10*time.Second),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			execution := executions.Add(1)
+			if execution > 1 {
+				*ret = http.StatusServiceUnavailable
+				return fmt.Errorf("execution %d failed", execution)
+			}
+			return map[string]int32{"executions": execution}
+		}),
+	))
+
+	RequireHTTPBodyAndNotHeader(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"executions": 1}`, []string{uhttp.CACHE_HEADER})
+	time.Sleep(60 * time.Millisecond)
+
+	// every request tries the handler again, but gets the stale entry as long as it fails
+	RequireHTTPBodyAndHeader(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"executions": 1}`, map[string][]string{uhttp.CACHE_HEADER: {uhttp.CACHE_HEADER_STALE_IF_ERROR}})
+	RequireHTTPBodyAndHeader(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"executions": 1}`, map[string][]string{uhttp.CACHE_HEADER: {uhttp.CACHE_HEADER_STALE_IF_ERROR}})
+	require.Equal(t, int32(3), executions.Load())
+}
+
+func TestCacheStaleIfErrorOtherFailures(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	executions := atomic.Int32{}
+	fail := atomic.Int32{}
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(50*time.Millisecond),
+		uhttp.WithCacheStaleIfError(10*time.Second),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			execution := executions.Add(1)
+			switch fail.Load() {
+			case http.StatusTeapot:
+				*ret = http.StatusTeapot
+				return fmt.Errorf("execution %d failed", execution)
+			case http.StatusInternalServerError:
+				return panickingModel{}
+			}
+			return map[string]int32{"executions": execution}
+		}),
+	))
+
+	RequireHTTPBodyAndNotHeader(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"executions": 1}`, []string{uhttp.CACHE_HEADER})
+	time.Sleep(60 * time.Millisecond)
+
+	// panics are replaced by the stale entry
+	fail.Store(http.StatusInternalServerError)
+	RequireHTTPBodyAndHeader(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"executions": 1}`, map[string][]string{uhttp.CACHE_HEADER: {uhttp.CACHE_HEADER_STALE_IF_ERROR}})
+
+	// client-errors are not
+	fail.Store(http.StatusTeapot)
+	RequireHTTPBodyAndNotHeader(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"error": "execution 3 failed"}`, []string{uhttp.CACHE_HEADER})
+
+	// a successful execution replaces the stale entry
+	fail.Store(0)
+	RequireHTTPBodyAndNotHeader(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"executions": 4}`, []string{uhttp.CACHE_HEADER})
+	RequireHTTPBodyAndHeader(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"executions": 4}`, map[string][]string{uhttp.CACHE_HEADER: {uhttp.CACHE_HEADER_HIT}})
+}
+
+func TestCacheKeyAuthorizationDefault(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	counter := setupCacheBudgetTest(t, u, "/test")
+
+	_, body1, header, _ := Run(t, u, http.MethodGet, "/test", map[string]string{"Authorization": "Bearer user1"})
+	require.Equal(t, "Authorization", header.Get(uhttp.HEADER_VARY))
+	_, body2, _, _ := Run(t, u, http.MethodGet, "/test", map[string]string{"Authorization": "Bearer user2"})
+	require.NotEqual(t, body1, body2)
+	require.Equal(t, 2, *counter)
+
+	_, body, header, _ := Run(t, u, http.MethodGet, "/test", map[string]string{"Authorization": "Bearer user1"})
+	require.Equal(t, body1, body)
+	require.Equal(t, "true", header.Get(uhttp.CACHE_HEADER))
+	require.Equal(t, 2, *counter)
+}
+
+func TestCacheKeyCredentialsWithCustomHeaders(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	counter := setupCacheBudgetTest(t, u, "/test", uhttp.WithCacheKeyHeaders("Accept-Language"))
+
+	_, _, header, _ := Run(t, u, http.MethodGet, "/test", map[string]string{"Accept-Language": "de", "Authorization": "Bearer user1"})
+	require.Equal(t, []string{"Accept-Language", "Authorization", uhttp.HEADER_ACCEPT_ENCODING}, header.Values(uhttp.HEADER_VARY))
+	// configuring other headers does not drop the credentials from the key
+	_, _, header, _ = Run(t, u, http.MethodGet, "/test", map[string]string{"Accept-Language": "de", "Authorization": "Bearer user2"})
+	require.Empty(t, header.Get(uhttp.CACHE_HEADER))
+	require.Equal(t, 2, *counter)
+
+	// undeclared cookies (e.g. analytics or consent) do not split the cache
+	_, _, header, _ = Run(t, u, http.MethodGet, "/test", map[string]string{"Accept-Language": "de"})
+	require.Empty(t, header.Get(uhttp.CACHE_HEADER))
+	_, _, header, _ = Run(t, u, http.MethodGet, "/test", map[string]string{"Accept-Language": "de", "Cookie": "consent=a"})
+	require.Equal(t, "true", header.Get(uhttp.CACHE_HEADER))
+	_, _, header, _ = Run(t, u, http.MethodGet, "/test", map[string]string{"Accept-Language": "de", "Cookie": "consent=b"})
+	require.Equal(t, "true", header.Get(uhttp.CACHE_HEADER))
+	require.Equal(t, 3, *counter)
+}
+
+func TestCacheKeyDeclaredCookies(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.ExposeCacheHandlers()
+	counter := setupCacheBudgetTest(t, u, "/test", uhttp.WithCacheKeyCookies("session"))
+
+	_, _, header, _ := Run(t, u, http.MethodGet, "/test", map[string]string{"Cookie": "session=a; consent=1"})
+	require.Equal(t, []string{"Authorization", "Cookie", uhttp.HEADER_ACCEPT_ENCODING}, header.Values(uhttp.HEADER_VARY))
+	_, _, header, _ = Run(t, u, http.MethodGet, "/test", map[string]string{"Cookie": "session=a; consent=2"})
+	require.Equal(t, "true", header.Get(uhttp.CACHE_HEADER))
+	_, _, header, _ = Run(t, u, http.MethodGet, "/test", map[string]string{"Cookie": "session=b; consent=1"})
+	require.Empty(t, header.Get(uhttp.CACHE_HEADER))
+	require.Equal(t, 2, *counter)
+
+	// the details document what the key is built from
+	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details", url.Values{"parsable": {"true"}})
+	require.Contains(t, body, `"keyedBy":["params","header:Authorization","cookie:session"]`)
+}
+
+func TestCacheKeyParams(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	counter := 0
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithCacheKeyIgnoredParams("utm_source"),
+		uhttp.WithOptionalGet(uhttp.R{"id": uhttp.STRING, "sort": uhttp.STRING, "utm_source": uhttp.STRING}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			counter++
+			return map[string]interface{}{"counter": counter}
+		}),
+	))
+
+	requireCached(t, u, "/test?id=1&sort=asc", false)
+	// the order of params does not matter
+	requireCached(t, u, "/test?sort=asc&id=1", true)
+	// ignored params do not matter
+	requireCached(t, u, "/test?id=1&utm_source=mail&sort=asc", true)
+	requireCached(t, u, "/test?id=1&sort=desc", false)
+	require.Equal(t, 2, counter)
+}
+
+func TestCacheKeyCookiesAndHeaders(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.ExposeCacheHandlers()
+	counter := setupCacheBudgetTest(t, u, "/test",
+		uhttp.WithCacheKeyHeaders("Accept-Language"),
+		uhttp.WithCacheKeyCookies("session"),
+		uhttp.WithCacheKeyIgnoreCredentials(),
+	)
+
+	_, _, header, _ := Run(t, u, http.MethodGet, "/test", map[string]string{"Accept-Language": "de", "Cookie": "session=a; other=1"})
+	require.Equal(t, []string{"Accept-Language", "Cookie", uhttp.HEADER_ACCEPT_ENCODING}, header.Values(uhttp.HEADER_VARY))
+	// other cookies and the authorization-header (credentials are ignored) are not part of the key
+	_, _, header, _ = Run(t, u, http.MethodGet, "/test", map[string]string{"Accept-Language": "de", "Cookie": "session=a; other=2", "Authorization": "Bearer x"})
+	require.Equal(t, "true", header.Get(uhttp.CACHE_HEADER))
+	_, _, header, _ = Run(t, u, http.MethodGet, "/test", map[string]string{"Accept-Language": "en", "Cookie": "session=a"})
+	require.Empty(t, header.Get(uhttp.CACHE_HEADER))
+	_, _, header, _ = Run(t, u, http.MethodGet, "/test", map[string]string{"Accept-Language": "de", "Cookie": "session=b"})
+	require.Empty(t, header.Get(uhttp.CACHE_HEADER))
+	require.Equal(t, 3, *counter)
+
+	// the details explain keys without exposing header- or cookie-values
+	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details", url.Values{"parsable": {"true"}})
+	require.Contains(t, body, `"key":{"headers":{"Accept-Language":"sha256:`)
+	require.Contains(t, body, `"cookies":{"session":"sha256:`)
+	require.NotContains(t, body, `session=a`)
+}
+
+func TestCacheKeyPrincipal(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.ExposeCacheHandlers()
+	hashedPassword := fmt.Sprintf("%x", sha256.Sum256([]byte("password")))
+	counter := setupCacheBudgetTest(t, u, "/test",
+		uhttp.WithMiddlewares(uhttp.AuthBasic(u, "user", hashedPassword)),
+		uhttp.WithCacheKeyIgnoreCredentials(),
+		uhttp.WithCacheKeyPrincipal(),
+	)
+
+	request := func() http.Header {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.SetBasicAuth("user", "password")
+		u.ServeMux().ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Header()
+	}
+
+	require.Empty(t, request().Get(uhttp.CACHE_HEADER))
+	require.Equal(t, "true", request().Get(uhttp.CACHE_HEADER))
+	require.Equal(t, []string{uhttp.HEADER_ACCEPT_ENCODING}, request().Values(uhttp.HEADER_VARY))
+	require.Equal(t, 1, *counter)
+
+	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details", url.Values{"parsable": {"true"}})
+	require.Contains(t, body, `"key":{"principal":"user","keyedBy":["params","principal"]}`)
+}
+
+func TestCacheKeyFunc(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	counter := setupCacheBudgetTest(t, u, "/test", uhttp.WithCacheKeyFunc(func(r *http.Request) string {
+		return r.Host
+	}))
+
+	request := func(host string) http.Header {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Host = host
+		u.ServeMux().ServeHTTP(w, req)
+		return w.Header()
+	}
+
+	require.Empty(t, request("a.example.com").Get(uhttp.CACHE_HEADER))
+	require.Equal(t, "true", request("a.example.com").Get(uhttp.CACHE_HEADER))
+	require.Empty(t, request("b.example.com").Get(uhttp.CACHE_HEADER))
+	require.Equal(t, 2, *counter)
+}
+
+func setupCacheTagsTest(t *testing.T, u *uhttp.UHTTP) {
+	u.ExposeCacheHandlers()
+	u.Handle("/users", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithCacheTags("users"),
+		uhttp.WithRequiredGet(uhttp.R{"id": uhttp.STRING}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			id := *uhttp.GetAsString("id", r)
+			uhttp.AddCacheTags(r, "user:"+id)
+			return map[string]string{"id": id}
+		}),
+		uhttp.WithPost(func(r *http.Request, ret *int) interface{} {
+			id := *uhttp.GetAsString("id", r)
+			return map[string]int{"invalidated": uhttp.GetUHTTP(r).Cache().InvalidateTags("user:" + id)}
+		}),
+	))
+	u.Handle("/users/list", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithCacheTags("users"),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return []string{"1", "2"}
+		}),
+	))
+	u.Handle("/other", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]string{"other": "ok"}
+		}),
+	))
+
+	for _, url := range []string{"/users?id=1", "/users?id=2", "/users/list", "/other"} {
+		requireCached(t, u, url, false)
+	}
+}
+
+func TestCacheInvalidateTags(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	setupCacheTagsTest(t, u)
+
+	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details", url.Values{"parsable": {"true"}})
+	require.Contains(t, body, `"tags":["users","user:1"]`)
+
+	// a mutation evicts exactly the affected entries
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodPost, "/users", url.Values{"id": {"1"}}, `{"invalidated": 1}`)
+	requireCached(t, u, "/users?id=2", true)
+	requireCached(t, u, "/users/list", true)
+	requireCached(t, u, "/users?id=1", false)
+
+	require.Equal(t, 3, u.Cache().InvalidateTags("users", "unknown"))
+	requireCached(t, u, "/other", true)
+	requireCached(t, u, "/users/list", false)
+
+	// the same via HTTP
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodPost, "/uhttp/cache/clear", url.Values{"tag": {"users"}}, `{"deletedEntries": 1}`)
+}
+
+func TestCacheInvalidatePatternAndWhere(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	setupCacheTagsTest(t, u)
+
+	require.Equal(t, 1, u.Cache().InvalidatePattern("/users/*"))
+	requireCached(t, u, "/users/list", false)
+	requireCached(t, u, "/users?id=1", true)
+
+	require.Equal(t, 2, u.Cache().InvalidatePattern("/users"))
+	requireCached(t, u, "/users?id=1", false)
+
+	require.Equal(t, 1, u.Cache().InvalidateWhere(func(handlerPattern string, entry cache.CacheEntry) bool {
+		return handlerPattern == "/users" && entry.Key().Params == "id=1"
+	}))
+	requireCached(t, u, "/users?id=1", false)
+	requireCached(t, u, "/other", true)
+}
+
+func TestCacheInvalidationBus(t *testing.T) {
+	bus := cache.NewMemoryBus()
+	replica1 := uhttp.NewUHTTP(uhttp.WithCacheInvalidationBus(bus))
+	replica2 := uhttp.NewUHTTP(uhttp.WithCacheInvalidationBus(bus))
+	setupCacheTagsTest(t, replica1)
+	setupCacheTagsTest(t, replica2)
+
+	// the mutation on one replica evicts the affected entries on all of them
+	RequireHTTPBodyJSONEq(t, replica1.ServeMux().ServeHTTP, http.MethodPost, "/users", url.Values{"id": {"1"}}, `{"invalidated": 1}`)
+	requireCached(t, replica2, "/users?id=2", true)
+	requireCached(t, replica2, "/users?id=1", false)
+
+	// so does the clear-handler
+	RequireHTTPBodyJSONEq(t, replica2.ServeMux().ServeHTTP, http.MethodPost, "/uhttp/cache/clear", url.Values{"path": {"/users/*"}}, `{"deletedEntries": 1}`)
+	requireCached(t, replica1, "/users/list", false)
+	requireCached(t, replica1, "/other", true)
+
+	replica1.Cache().InvalidatePattern("/other")
+	requireCached(t, replica2, "/other", false)
+}
+
+func TestCacheInvalidationBusShutdown(t *testing.T) {
+	bus := cache.NewMemoryBus()
+	replica1 := uhttp.NewUHTTP(uhttp.WithCacheInvalidationBus(bus))
+	replica2 := uhttp.NewUHTTP(uhttp.WithCacheInvalidationBus(bus))
+	setupCacheTagsTest(t, replica1)
+	setupCacheTagsTest(t, replica2)
+
+	// a replica which was shut down does not receive invalidations anymore
+	require.NoError(t, replica2.Shutdown(context.Background()))
+	replica1.Cache().InvalidatePattern("/other")
+	requireCached(t, replica2, "/other", true)
+}
+
+func TestCacheInvalidationHTTPBus(t *testing.T) {
+	bus2 := cache.NewHTTPBus(nil, nil)
+	replica2 := uhttp.NewUHTTP(uhttp.WithCacheInvalidationBus(bus2))
+	replica2.ServeMux().Handle("/uhttp/cache/invalidations", bus2)
+	server2 := httptest.NewServer(replica2.ServeMux())
+	defer server2.Close()
+
+	bus1 := cache.NewHTTPBus([]string{server2.URL + "/uhttp/cache/invalidations"}, server2.Client())
+	replica1 := uhttp.NewUHTTP(uhttp.WithCacheInvalidationBus(bus1))
+
+	setupCacheTagsTest(t, replica1)
+	setupCacheTagsTest(t, replica2)
+
+	require.Equal(t, 3, replica1.Cache().InvalidateTags("users"))
+	requireCached(t, replica2, "/users?id=1", false)
+	requireCached(t, replica2, "/users/list", false)
+	requireCached(t, replica2, "/other", true)
+
+	// unreachable peers are reported
+	unreachable := cache.NewHTTPBus([]string{"http://127.0.0.1:1/uhttp/cache/invalidations"}, nil)
+	require.Error(t, unreachable.Publish(cache.Invalidation{Tag: "users"}))
+}
+
+func TestCacheInvalidationHTTPBusSlowPeers(t *testing.T) {
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hanging.Close()
+	defer close(release)
+
+	delivered := 0
+	received := cache.NewHTTPBus(nil, nil)
+	received.Subscribe(func(cache.Invalidation) { delivered++ })
+	healthy := httptest.NewServer(received)
+	defer healthy.Close()
+
+	// peers are published to in parallel, a hanging peer only delays the publish up to the client's timeout
+	bus := cache.NewHTTPBus([]string{hanging.URL, hanging.URL, healthy.URL}, &http.Client{Timeout: 200 * time.Millisecond})
+	start := time.Now()
+	err := bus.Publish(cache.Invalidation{Tag: "users"})
+	require.Less(t, time.Since(start), time.Second)
+	require.ErrorContains(t, err, hanging.URL)
+	require.NotContains(t, err.Error(), healthy.URL)
+	require.Equal(t, 1, delivered)
+}
+
+func TestCacheSnapshots(t *testing.T) {
+	dir := t.TempDir()
+
+	u := uhttp.NewUHTTP(uhttp.WithCacheSnapshots(dir, 0))
+	counter := setupCacheBudgetTest(t, u, "/test", uhttp.WithCachePersistEncodings(), uhttp.WithCompressionMinSize(0))
+	requireCached(t, u, "/test?id=1", false)
+	requireCached(t, u, "/test?id=2", false)
+	require.NoError(t, u.SnapshotCaches())
+	require.FileExists(t, filepath.Join(dir, url.PathEscape("/test")+".snapshot"))
+
+	// a new instance starts warm
+	restarted := uhttp.NewUHTTP(uhttp.WithCacheSnapshots(dir, 0))
+	restartedCounter := setupCacheBudgetTest(t, restarted, "/test", uhttp.WithCachePersistEncodings(), uhttp.WithCompressionMinSize(0))
+	RequireHTTPBodyJSONEq(t, restarted.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{"id": {"2"}}, `{"id": "2", "counter": 2}`)
+	requireCached(t, restarted, "/test?id=1", true)
+	_, body, header, _ := Run(t, restarted, http.MethodGet, "/test?id=1", map[string]string{"Accept-Encoding": "gzip"})
+	require.Equal(t, uhttp.ENCODING_GZIP, header.Get(uhttp.HEADER_CONTENT_ENCODING))
+	require.NotEmpty(t, body)
+	require.Equal(t, 2, *counter)
+	require.Equal(t, 0, *restartedCounter)
+}
+
+func TestCacheSnapshotsOnShutdown(t *testing.T) {
+	dir := t.TempDir()
+
+	u := uhttp.NewUHTTP(uhttp.WithCacheSnapshots(dir, time.Hour))
+	setupCacheBudgetTest(t, u, "/test")
+	requireCached(t, u, "/test?id=1", false)
+	require.NoError(t, u.Shutdown(context.Background()))
+
+	restarted := uhttp.NewUHTTP(uhttp.WithCacheSnapshots(dir, time.Hour))
+	setupCacheBudgetTest(t, restarted, "/test")
+	requireCached(t, restarted, "/test?id=1", true)
+}
+
+func TestCacheSnapshotsPeriodicStopsOnShutdown(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, url.PathEscape("/test")+".snapshot")
+
+	u := uhttp.NewUHTTP(uhttp.WithAddress("127.0.0.1:0"), uhttp.WithCacheSnapshots(dir, 10*time.Millisecond))
+	setupCacheBudgetTest(t, u, "/test")
+	requireCached(t, u, "/test?id=1", false)
+	served := make(chan error, 1)
+	go func() { served <- u.ListenAndServe() }()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(snapshot)
+		return err == nil
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, u.Shutdown(context.Background()))
+	require.ErrorIs(t, <-served, http.ErrServerClosed)
+
+	// the final snapshot is not overwritten by periodic ones afterwards
+	require.NoError(t, os.Remove(snapshot))
+	time.Sleep(50 * time.Millisecond)
+	require.NoFileExists(t, snapshot)
+}
+
+func TestCacheSnapshotsExpired(t *testing.T) {
+	dir := t.TempDir()
+
+	u := uhttp.NewUHTTP(uhttp.WithCacheSnapshots(dir, 0))
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(50*time.Millisecond),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]string{"ok": "ok"}
+		}),
+	))
+	requireCached(t, u, "/test", false)
+	require.NoError(t, u.SnapshotCaches())
+	time.Sleep(100 * time.Millisecond)
+
+	restarted := uhttp.NewUHTTP(uhttp.WithCacheSnapshots(dir, 0))
+	restarted.ExposeCacheHandlers()
+	restarted.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(50*time.Millisecond),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]string{"ok": "ok"}
+		}),
+	))
+	require.Contains(t, assert.HTTPBody(restarted.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/size", nil), `"/test":{"entries":0`)
+}
+
+func TestCacheSnapshotsIncompatible(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := `{"format":"uhttp-cache-snapshot","version":99,"entryVersion":1,"handlerPattern":"/test"}` + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, url.PathEscape("/test")+".snapshot"), []byte(snapshot), 0644))
+
+	u := uhttp.NewUHTTP(uhttp.WithCacheSnapshots(dir, 0))
+	counter := setupCacheBudgetTest(t, u, "/test")
+	requireCached(t, u, "/test", false)
+	require.Equal(t, 1, *counter)
+
+	c := cache.NewCache(time.Minute, "/test")
+	_, err := c.LoadSnapshot(strings.NewReader(snapshot))
+	require.ErrorContains(t, err, "incompatible snapshot")
+	_, err = c.LoadSnapshot(strings.NewReader(strings.Replace(snapshot, `"version":99`, `"version":1`, 1)))
+	require.NoError(t, err)
+	_, err = cache.NewCache(time.Minute, "/other").LoadSnapshot(strings.NewReader(strings.Replace(snapshot, `"version":99`, `"version":1`, 1)))
+	require.ErrorContains(t, err, "cannot be loaded")
+}
+
+func TestCachePredicate(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	counter := 0
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithOptionalGet(uhttp.R{"state": uhttp.STRING}),
+		uhttp.WithCachePredicate(func(r *http.Request, statusCode int, model interface{}) bool {
+			return r.URL.Query().Get("state") != "pending" && statusCode != http.StatusInternalServerError
+		}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			counter++
+			if r.URL.Query().Get("state") == "missing" {
+				*ret = http.StatusNotFound
+			}
+			return map[string]int{"counter": counter}
+		}),
+	))
+
+	requireCached(t, u, "/test?state=pending", false)
+	requireCached(t, u, "/test?state=pending", false)
+	requireCached(t, u, "/test?state=final", false)
+	requireCached(t, u, "/test?state=final", true)
+	// the predicate replaces the default, so failed requests can be cached as well
+	requireCached(t, u, "/test?state=missing", false)
+	requireCached(t, u, "/test?state=missing", true)
+	require.Equal(t, 4, counter)
+}
+
+func TestCacheTTLPerResponse(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.ExposeCacheHandlers()
+	counter := 0
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithOptionalGet(uhttp.R{"state": uhttp.STRING}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			counter++
+			if r.URL.Query().Get("state") == "pending" {
+				uhttp.SetCacheTTL(r, 50*time.Millisecond)
+			} else {
+				uhttp.SetCacheTTL(r, time.Hour)
+			}
+			return map[string]int{"counter": counter}
+		}),
+	))
+
+	_, _, header, _ := Run(t, u, http.MethodGet, "/test?state=pending", nil)
+	require.Equal(t, "max-age=0", header.Get(uhttp.HEADER_CACHE_CONTROL))
+	_, _, header, _ = Run(t, u, http.MethodGet, "/test?state=final", nil)
+	require.Equal(t, "max-age=3600", header.Get(uhttp.HEADER_CACHE_CONTROL))
+
+	requireCached(t, u, "/test?state=pending", true)
+	time.Sleep(100 * time.Millisecond)
+	requireCached(t, u, "/test?state=pending", false)
+	// the handler's maxAge does not apply anymore
+	_, _, header, _ = Run(t, u, http.MethodGet, "/test?state=final", nil)
+	require.Equal(t, "true", header.Get(uhttp.CACHE_HEADER))
+	require.Equal(t, "max-age=3600", header.Get(uhttp.HEADER_CACHE_CONTROL))
+	require.Equal(t, 3, counter)
+
+	body := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details", url.Values{"parsable": {"true"}})
+	require.Contains(t, body, `"TTL":"1h0m0s"`)
+}
+
+func TestCachePost(t *testing.T) {
+	type query struct {
+		Filter string `json:"filter"`
+	}
+
+	u := uhttp.NewUHTTP()
+	counter := 0
+	u.Handle("/query", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithCachePost(),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			counter++
+			return map[string]interface{}{"method": "get", "counter": counter}
+		}),
+		uhttp.WithPostModel(query{}, func(r *http.Request, model interface{}, ret *int) interface{} {
+			counter++
+			return map[string]interface{}{"filter": model.(*query).Filter, "counter": counter}
+		}),
+	))
+
+	post := func(body string) (string, http.Header) {
+		w := httptest.NewRecorder()
+		u.ServeMux().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body)))
+		return w.Body.String(), w.Header()
+	}
+
+	body, header := post(`{"filter": "a"}`)
+	require.JSONEq(t, `{"filter": "a", "counter": 1}`, body)
+	require.Empty(t, header.Get(uhttp.CACHE_HEADER))
+	body, header = post(`{"filter": "a"}`)
+	require.JSONEq(t, `{"filter": "a", "counter": 1}`, body)
+	require.Equal(t, "true", header.Get(uhttp.CACHE_HEADER))
+	body, _ = post(`{"filter": "b"}`)
+	require.JSONEq(t, `{"filter": "b", "counter": 2}`, body)
+
+	// GET and POST do not share entries
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/query", nil, `{"method": "get", "counter": 3}`)
+}
+
+func TestCachePostMultipartIsNotCached(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	counter := 0
+	u.Handle("/upload", uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithCachePost(),
+		uhttp.WithPostModel(testFormModel{}, func(r *http.Request, model interface{}, ret *int) interface{} {
+			counter++
+			reader, err := model.(*testFormModel).File.Open()
+			require.NoError(t, err)
+			defer reader.Close()
+			content, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			return map[string]interface{}{"content": string(content), "counter": counter}
+		}),
+	))
+
+	upload := func(content string) (string, http.Header) {
+		req := testMultipartRequest(t, url.Values{"name": {"test"}}, map[string]string{"file": content})
+		req.URL.Path = "/upload"
+		w := httptest.NewRecorder()
+		u.ServeMux().ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String(), w.Header()
+	}
+
+	body, _ := upload("first")
+	require.JSONEq(t, `{"content": "first", "counter": 1}`, body)
+	body, header := upload("second")
+	require.JSONEq(t, `{"content": "second", "counter": 2}`, body)
+	require.Empty(t, header.Get(uhttp.CACHE_HEADER))
+}
+
+func TestCacheEncodingsZstd(t *testing.T) {
+	u := uhttp.NewUHTTP(uhttp.WithZstdCompression(true, 3))
+	u.ExposeCacheHandlers()
+
+	handler := uhttp.NewHandler(
+		uhttp.WithCache(10*time.Second),
+		uhttp.WithCachePersistEncodings(),
+		uhttp.WithCompressionMinSize(0),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]string{"all": "ok"}
+		}),
+	)
+
+	u.Handle("/cache", handler)
+
+	// populate first
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/cache", nil, `{"all": "ok"}`)
+
+	stats := assert.HTTPBody(u.ServeMux().ServeHTTP, http.MethodGet, "/uhttp/cache/details", url.Values{"parsable": {"true"}})
+	require.Contains(t, stats, `"cachedBodyZstd":true`)
+
+	// served from the persisted zstd-body
+	req := httptest.NewRequest(http.MethodGet, "/cache", nil)
+	req.Header.Set("Accept-Encoding", "zstd, br")
+	w := httptest.NewRecorder()
+	u.ServeMux().ServeHTTP(w, req)
+	res := w.Result()
+	require.Equal(t, "zstd", res.Header.Get("Content-Encoding"))
+	require.NotEmpty(t, res.Header.Get(uhttp.CACHE_HEADER))
+	body, err := uhttp.DecodeResponseBody(res)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"all": "ok"}`, string(body))
+}
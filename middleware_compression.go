@@ -0,0 +1,122 @@
+package uhttp
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+)
+
+// Compression levels per encoding, levels outside of an encoding's range are clamped
+// zero levels are taken from the defaults (gzip.NoCompression cannot be chosen, see WithCompressionMinSize instead)
+type CompressionLevels struct {
+	// 0-11
+	Brotli int
+	// gzip.HuffmanOnly-gzip.BestCompression
+	Gzip int
+	// flate.HuffmanOnly-flate.BestCompression
+	Deflate int
+	// levels of the zstd command line (1-22)
+	Zstd int
+}
+
+// levels for dynamic responses, they are compressed for every request so speed matters more than ratio
+var defaultDynamicCompressionLevels = CompressionLevels{
+	Brotli:  4,
+	Gzip:    gzip.DefaultCompression,
+	Deflate: flate.DefaultCompression,
+	Zstd:    3,
+}
+
+// Levels for dynamic responses if not set otherwise (see WithDynamicCompression)
+func DefaultDynamicCompressionLevels() CompressionLevels {
+	return defaultDynamicCompressionLevels
+}
+
+// responses smaller than this are not worth compressing (the encoding's overhead outweighs the savings)
+const defaultCompressionMinSize = 1024
+
+func (l CompressionLevels) merged(defaults CompressionLevels) CompressionLevels {
+	if l.Brotli == 0 {
+		l.Brotli = defaults.Brotli
+	}
+	if l.Gzip == 0 {
+		l.Gzip = defaults.Gzip
+	}
+	if l.Deflate == 0 {
+		l.Deflate = defaults.Deflate
+	}
+	if l.Zstd == 0 {
+		l.Zstd = defaults.Zstd
+	}
+	return l
+}
+
+func (l CompressionLevels) clamped() CompressionLevels {
+	return CompressionLevels{
+		Brotli:  clampLevel(l.Brotli, 0, 11),
+		Gzip:    clampLevel(l.Gzip, gzip.HuffmanOnly, gzip.BestCompression),
+		Deflate: clampLevel(l.Deflate, flate.HuffmanOnly, flate.BestCompression),
+		Zstd:    clampLevel(l.Zstd, 1, 22),
+	}
+}
+
+func (l CompressionLevels) level(encoding string) int {
+	switch encoding {
+	case ENCODING_BROTLI:
+		return l.Brotli
+	case ENCODING_GZIP:
+		return l.Gzip
+	case ENCODING_DEFLATE:
+		return l.Deflate
+	case ENCODING_ZSTD:
+		return l.Zstd
+	}
+	return 0
+}
+
+func clampLevel(level, min, max int) int {
+	if level < min {
+		return min
+	} else if level > max {
+		return max
+	}
+	return level
+}
+
+// compression of a handler's dynamic responses
+type compressionPolicy struct {
+	levels  CompressionLevels
+	minSize int
+}
+
+// attaches the handler's compression policy to the context (it is applied when rendering)
+func compressionMiddleware(u *UHTTP, opts handlerOptions) Middleware {
+	policy := &compressionPolicy{
+		levels:  u.opts.dynamicCompressionLevels,
+		minSize: u.opts.compressionMinSize,
+	}
+	if opts.compressionLevels != nil {
+		policy.levels = opts.compressionLevels.merged(u.opts.dynamicCompressionLevels).clamped()
+	}
+	if opts.compressionMinSize != nil {
+		policy.minSize = *opts.compressionMinSize
+	}
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), CtxKeyCompression, policy)))
+		}
+	}
+}
+
+// compression policy of the request, falls back to the global levels (e.g. for static files)
+// static files are compressed only once, so they are not subject to the minimum size
+func (u *UHTTP) getCompressionPolicy(r *http.Request) *compressionPolicy {
+	if policy, ok := r.Context().Value(CtxKeyCompression).(*compressionPolicy); ok {
+		return policy
+	}
+	return &compressionPolicy{
+		levels: u.opts.dynamicCompressionLevels,
+	}
+}
@@ -4,38 +4,160 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"reflect"
 )
 
 func getParamsMiddleware(u *UHTTP, opts handlerOptions) func(next http.HandlerFunc) http.HandlerFunc {
+	// inspect the paramsModel only once, an invalid definition is a bug in the code
+	var paramsModelType reflect.Type
+	var paramsModelFields []paramField
+	if opts.paramsModel != nil {
+		var err error
+		paramsModelFields, err = paramFieldsFromModel(opts.paramsModel, TAG_QUERY, TAG_HEADER, TAG_COOKIE)
+		if err != nil {
+			err = fmt.Errorf("invalid paramsModel for handler %s (%s)", opts.handlerPattern, err)
+			u.Log().Errorf("%s", err)
+			panic(err)
+		}
+		paramsModelType = reflect.TypeOf(opts.paramsModel)
+	}
+
+	// params given more than once are only allowed for LIST requirements
+	listParams := map[string]bool{}
+	for _, requirements := range []R{opts.requiredGet, opts.optionalGet} {
+		for key, requirement := range requirements {
+			if _, ok := requirement.(ListRequirement); ok {
+				listParams[key] = true
+			}
+		}
+	}
+
+	// headers and cookies are only extracted if they are declared
+	headerKeys := declaredParamKeys(opts.requiredHeader, opts.optionalHeader)
+	cookieKeys := declaredParamKeys(opts.requiredCookie, opts.optionalCookie)
+
+	for _, field := range paramsModelFields {
+		switch field.source {
+		case TAG_QUERY:
+			if _, ok := field.requirement.(ListRequirement); ok {
+				listParams[field.key] = true
+			}
+		case TAG_HEADER:
+			headerKeys = append(headerKeys, field.key)
+		case TAG_COOKIE:
+			cookieKeys = append(cookieKeys, field.key)
+		}
+	}
+
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			actualRaw := r.URL.Query() // map[string][]string
-			actual := map[string]string{}
-			for key, values := range actualRaw {
-				if len(values) > 0 {
-					if len(values) > 1 {
-						u.RenderError(w, r, fmt.Errorf("param %s has more than one value (given multiple times), this is not supported", key))
-						return
-					}
-					actual[key] = values[0]
+			actual := r.URL.Query()
+			for key, values := range actual {
+				if len(values) > 1 && !listParams[key] {
+					u.RenderError(w, r, fmt.Errorf("param %s has more than one value (given multiple times), this is not supported", key))
+					return
 				}
 			}
 
 			paramMap := R{}
 
-			err := u.ValidateParams(opts.requiredGet, actual, paramMap, true)
+			err := u.ValidateParamValues(opts.requiredGet, actual, paramMap, true)
 			if err != nil {
 				u.RenderError(w, r, fmt.Errorf("%v", err))
 				return
 			}
 
-			err = u.ValidateParams(opts.optionalGet, actual, paramMap, false)
+			err = u.ValidateParamValues(opts.optionalGet, actual, paramMap, false)
 			if err != nil {
 				u.RenderError(w, r, fmt.Errorf("%v", err))
+				return
 			}
 
-			ctx := context.WithValue(r.Context(), CtxKeyGetParams, paramMap)
+			actualHeaders := headerParamValues(r.Header, headerKeys)
+			headerMap := R{}
+			if err := u.ValidateParamValues(opts.requiredHeader, actualHeaders, headerMap, true); err != nil {
+				u.RenderError(w, r, fmt.Errorf("%v", err))
+				return
+			}
+			if err := u.ValidateParamValues(opts.optionalHeader, actualHeaders, headerMap, false); err != nil {
+				u.RenderError(w, r, fmt.Errorf("%v", err))
+				return
+			}
+
+			actualCookies := cookieParamValues(r, cookieKeys)
+			cookieMap := R{}
+			if err := u.ValidateParamValues(opts.requiredCookie, actualCookies, cookieMap, true); err != nil {
+				u.RenderError(w, r, fmt.Errorf("%v", err))
+				return
+			}
+			if err := u.ValidateParamValues(opts.optionalCookie, actualCookies, cookieMap, false); err != nil {
+				u.RenderError(w, r, fmt.Errorf("%v", err))
+				return
+			}
+
+			ctx := r.Context()
+			if paramsModelType != nil {
+				model, err := bindParams(
+					paramsModelType, paramsModelFields,
+					map[string]url.Values{TAG_QUERY: actual, TAG_HEADER: actualHeaders, TAG_COOKIE: actualCookies},
+					map[string]R{TAG_QUERY: paramMap, TAG_HEADER: headerMap, TAG_COOKIE: cookieMap},
+				)
+				if err != nil {
+					u.RenderError(w, r, err)
+					return
+				}
+				ctx = context.WithValue(ctx, CtxKeyParamsModel, model)
+			}
+
+			// the access-log is written by an outer middleware, hand over all params
+			addParamsLogOutput(u, w, "urlParam", paramMap)
+			addParamsLogOutput(u, w, "headerParam", headerMap)
+			addParamsLogOutput(u, w, "cookieParam", cookieMap)
+
+			ctx = context.WithValue(ctx, CtxKeyGetParams, paramMap)
+			ctx = context.WithValue(ctx, CtxKeyHeaderParams, headerMap)
+			ctx = context.WithValue(ctx, CtxKeyCookieParams, cookieMap)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 	}
 }
+
+func declaredParamKeys(requirements ...R) []string {
+	keys := []string{}
+	for _, requirement := range requirements {
+		for key := range requirement {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// headerParamValues extracts all declared headers (keyed as declared, the lookup is case-insensitive)
+func headerParamValues(header http.Header, keys []string) url.Values {
+	actual := url.Values{}
+	for _, key := range keys {
+		if values := header.Values(key); len(values) != 0 {
+			actual[key] = values
+		}
+	}
+	return actual
+}
+
+// cookieParamValues extracts all declared cookies
+func cookieParamValues(r *http.Request, keys []string) url.Values {
+	actual := url.Values{}
+	cookies := r.Cookies()
+	for _, key := range keys {
+		// a cookie can be declared more than once (e.g. in R and in the paramsModel)
+		if _, ok := actual[key]; ok {
+			continue
+		}
+		for _, cookie := range cookies {
+			if cookie.Name == key {
+				actual.Add(key, cookie.Value)
+			}
+		}
+	}
+	return actual
+}
@@ -4,10 +4,14 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/dunv/uhttp"
+	"github.com/stretchr/testify/require"
 )
 
 func testRequirementFail(requirement uhttp.R, actual map[string]string, unexpectedKey string, t *testing.T) {
@@ -310,3 +314,414 @@ func TestRequirementsInHandler(t *testing.T) {
 		"duration": "5m0s"
 	}`)
 }
+
+type testParamsModel struct {
+	String   string         `query:"string" required:"true"`
+	Int      int            `query:"int" default:"42"`
+	Int64    *int64         `query:"int64"`
+	Float64  float64        `query:"float64"`
+	Date     time.Time      `query:"date" format:"shortDate"`
+	Duration *time.Duration `query:"duration"`
+	Enum     string         `query:"enum" enum:"open,closed" default:"open"`
+	Ignored  string
+}
+
+func testParamsModelHandler() uhttp.Handler {
+	return uhttp.NewHandler(
+		uhttp.WithParamsModel(testParamsModel{}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			params := uhttp.GetParamsModel(r).(*testParamsModel)
+			return map[string]interface{}{
+				"string":   params.String,
+				"int":      params.Int,
+				"int64":    params.Int64,
+				"float64":  params.Float64,
+				"date":     params.Date,
+				"duration": params.Duration,
+				"enum":     params.Enum,
+				"fromMap":  uhttp.GetAsInt("int", r),
+			}
+		}),
+	)
+}
+
+func TestParamsModel(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.Handle("/test", testParamsModelHandler())
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{
+		"string":   []string{"myString"},
+		"int":      []string{"1"},
+		"int64":    []string{"2"},
+		"float64":  []string{"42.42"},
+		"date":     []string{"2021-10-15"},
+		"duration": []string{"1s"},
+		"enum":     []string{"closed"},
+	}, `{
+		"string": "myString",
+		"int": 1,
+		"int64": 2,
+		"float64": 42.42,
+		"date": "2021-10-15T00:00:00Z",
+		"duration": 1000000000,
+		"enum": "closed",
+		"fromMap": 1
+	}`)
+}
+
+func TestParamsModelDefaults(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.Handle("/test", testParamsModelHandler())
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{
+		"string": []string{"myString"},
+	}, `{
+		"string": "myString",
+		"int": 42,
+		"int64": null,
+		"float64": 0,
+		"date": "0001-01-01T00:00:00Z",
+		"duration": null,
+		"enum": "open",
+		"fromMap": 42
+	}`)
+}
+
+func TestParamsModelFail(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.Handle("/test", testParamsModelHandler())
+	require.HTTPStatusCode(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{}, http.StatusBadRequest)
+	require.HTTPStatusCode(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{
+		"string": []string{"myString"},
+		"enum":   []string{"invalid"},
+	}, http.StatusBadRequest)
+	require.HTTPStatusCode(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{
+		"string": []string{"myString"},
+		"int":    []string{"notAnInt"},
+	}, http.StatusBadRequest)
+}
+
+type testStatus string
+
+func TestParamsModelNamedEnum(t *testing.T) {
+	type model struct {
+		Status   testStatus   `query:"status" enum:"open,closed"`
+		Statuses []testStatus `query:"statuses" enum:"open,closed"`
+		Optional *testStatus  `query:"optional" enum:"open,closed"`
+	}
+	u := uhttp.NewUHTTP()
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithParamsModel(model{}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return uhttp.GetParamsModel(r)
+		}),
+	))
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{
+		"status":   []string{"open"},
+		"statuses": []string{"open,closed"},
+		"optional": []string{"closed"},
+	}, `{"Status": "open", "Statuses": ["open", "closed"], "Optional": "closed"}`)
+	require.HTTPStatusCode(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{
+		"status": []string{"invalid"},
+	}, http.StatusBadRequest)
+}
+
+func TestParamsModelInvalidDefinition(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	require.Panics(t, func() {
+		u.Handle("/test", uhttp.NewHandler(
+			uhttp.WithParamsModel(struct {
+				Date int `query:"date" format:"shortDate"`
+			}{}),
+			uhttp.WithGet(func(r *http.Request, ret *int) interface{} { return nil }),
+		))
+	})
+}
+
+func TestListRequirementSuccess(t *testing.T) {
+	testRequirementSuccessValues(
+		uhttp.R{"test": uhttp.LIST(uhttp.INT)},
+		url.Values{"test": {"1", "2,3"}},
+		"test",
+		[]int{1, 2, 3},
+		t,
+	)
+}
+
+func TestListEnumRequirementSuccess(t *testing.T) {
+	testRequirementSuccessValues(
+		uhttp.R{"test": uhttp.LIST(uhttp.ENUM("open", "closed"))},
+		url.Values{"test": {"open,closed"}},
+		"test",
+		[]string{"open", "closed"},
+		t,
+	)
+}
+
+func TestListRequirementFail(t *testing.T) {
+	testRequirementFailValues(uhttp.R{"test": uhttp.LIST(uhttp.INT)}, url.Values{"test": {"1", "a"}}, "test", t)
+	testRequirementFailValues(uhttp.R{"test": uhttp.LIST(uhttp.ENUM("open"))}, url.Values{"test": {"open,closed"}}, "test", t)
+	testRequirementFailValues(uhttp.R{"test": uhttp.LIST(uhttp.INT).Min(2)}, url.Values{"test": {"1"}}, "test", t)
+	testRequirementFailValues(uhttp.R{"test": uhttp.LIST(uhttp.INT).Max(2)}, url.Values{"test": {"1,2,3"}}, "test", t)
+	testRequirementFailValues(uhttp.R{"test": uhttp.INT}, url.Values{"test": {"1", "2"}}, "test", t)
+}
+
+func TestListRequirementAbsent(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	validatedMap := uhttp.R{}
+	require.NoError(t, u.ValidateParamValues(uhttp.R{"test": uhttp.LIST(uhttp.INT)}, url.Values{}, validatedMap, false))
+	require.NotContains(t, validatedMap, "test")
+
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithOptionalGet(uhttp.R{"status": uhttp.LIST(uhttp.ENUM("open", "closed"))}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]bool{"isNil": uhttp.GetAsStringSlice("status", r) == nil}
+		}),
+	))
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{}, `{"isNil": true}`)
+}
+
+func testRequirementSuccessValues(requirement uhttp.R, actual url.Values, expectedKey string, expectedValue interface{}, t *testing.T) {
+	u := uhttp.NewUHTTP()
+	validatedMap := uhttp.R{}
+	require.NoError(t, u.ValidateParamValues(requirement, actual, validatedMap, true))
+	require.Equal(t, expectedValue, validatedMap[expectedKey])
+}
+
+func testRequirementFailValues(requirement uhttp.R, actual url.Values, unexpectedKey string, t *testing.T) {
+	u := uhttp.NewUHTTP()
+	validatedMap := uhttp.R{}
+	require.Error(t, u.ValidateParamValues(requirement, actual, validatedMap, true))
+	require.NotContains(t, validatedMap, unexpectedKey)
+}
+
+func TestListRequirementsInHandler(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	handler := uhttp.NewHandler(
+		uhttp.WithRequiredGet(uhttp.R{
+			"id": uhttp.LIST(uhttp.INT64).Min(1),
+		}),
+		uhttp.WithOptionalGet(uhttp.R{
+			"status": uhttp.LIST(uhttp.ENUM("open", "closed")),
+		}),
+		uhttp.WithParamsModel(struct {
+			Dates []time.Time `query:"date" format:"shortDate" maxItems:"2"`
+		}{}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]interface{}{
+				"id":     uhttp.GetAsInt64Slice("id", r),
+				"status": uhttp.GetAsStringSlice("status", r),
+				"date":   uhttp.GetAsTimeSlice("date", r),
+			}
+		}),
+	)
+	u.Handle("/test", handler)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{
+		"id":     []string{"1", "2"},
+		"status": []string{"open,closed"},
+		"date":   []string{"2021-10-15", "2021-10-16"},
+	}, `{
+		"id": [1, 2],
+		"status": ["open", "closed"],
+		"date": ["2021-10-15T00:00:00Z", "2021-10-16T00:00:00Z"]
+	}`)
+	require.HTTPStatusCode(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{
+		"id":   []string{"1"},
+		"date": []string{"2021-10-15,2021-10-16,2021-10-17"},
+	}, http.StatusBadRequest)
+	require.HTTPStatusCode(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{
+		"id":    []string{"1"},
+		"other": []string{"1", "2"},
+	}, http.StatusBadRequest)
+}
+
+type testID struct {
+	prefix string
+	id     int
+}
+
+func (i testID) String() string {
+	return fmt.Sprintf("%s-%d", i.prefix, i.id)
+}
+
+var TEST_ID = uhttp.RegisterParamType("testID", func(value string) (testID, error) {
+	var id testID
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) != 2 {
+		return id, fmt.Errorf("invalid testID %s", value)
+	}
+	number, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return id, fmt.Errorf("invalid testID %s", value)
+	}
+	return testID{prefix: parts[0], id: number}, nil
+})
+
+func TestCustomParamType(t *testing.T) {
+	testRequirementSuccess(uhttp.R{"test": TEST_ID}, map[string]string{"test": "abc-1"}, "test", testID{prefix: "abc", id: 1}, t)
+	testRequirementFail(uhttp.R{"test": TEST_ID}, map[string]string{"test": "abc"}, "test", t)
+	testRequirementSuccessValues(uhttp.R{"test": uhttp.LIST(TEST_ID)}, url.Values{"test": {"a-1,b-2"}}, "test", []testID{{"a", 1}, {"b", 2}}, t)
+	require.Panics(t, func() {
+		uhttp.RegisterParamType("testID", func(value string) (string, error) { return value, nil })
+	})
+}
+
+func TestUnknownParamType(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	err := u.ValidateParams(uhttp.R{"test": uhttp.ParamType("unknown")}, map[string]string{"test": "1"}, uhttp.R{}, true)
+	require.ErrorContains(t, err, "unknown param requirement unknown")
+}
+
+var TEST_NON_EMPTY = uhttp.RegisterParamType("testNonEmpty", func(value string) (string, error) {
+	if value == "" {
+		return "empty", nil
+	}
+	return value, nil
+})
+
+func TestOptionalParams(t *testing.T) {
+	u := uhttp.NewUHTTP()
+
+	// absent optional params are not parsed
+	validated := uhttp.R{}
+	require.NoError(t, u.ValidateParams(uhttp.R{"test": TEST_NON_EMPTY, "limit": uhttp.INT.Min(1)}, map[string]string{}, validated, false))
+	require.Empty(t, validated)
+
+	// constraints of present optional params are enforced
+	err := u.ValidateParams(uhttp.R{"limit": uhttp.INT.Min(1)}, map[string]string{"limit": "0"}, uhttp.R{}, false)
+	require.ErrorContains(t, err, "param limit: constraint min(1) failed, got 0")
+
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithOptionalGet(uhttp.R{"limit": uhttp.INT.Min(1)}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]interface{}{"limit": uhttp.GetAsInt("limit", r)}
+		}),
+	))
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", nil, `{"limit": null}`)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{"limit": {"2"}}, `{"limit": 2}`)
+	require.HTTPStatusCode(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{"limit": {"0"}}, http.StatusBadRequest)
+}
+
+func TestOptionalParamErrorStopsHandler(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	executed := false
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithOptionalGet(uhttp.R{"test": uhttp.ParamType("unknown")}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			executed = true
+			return map[string]string{"ok": "ok"}
+		}),
+	))
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{"test": {"1"}}, `{"error": "unknown param requirement unknown"}`)
+	require.False(t, executed)
+}
+
+func TestConstrainedParamType(t *testing.T) {
+	testRequirementSuccess(uhttp.R{"test": uhttp.INT.Min(1).Max(100)}, map[string]string{"test": "100"}, "test", 100, t)
+	testRequirementFail(uhttp.R{"test": uhttp.INT.Min(1).Max(100)}, map[string]string{"test": "0"}, "test", t)
+	testRequirementFail(uhttp.R{"test": uhttp.FLOAT64.Max(1)}, map[string]string{"test": "1.5"}, "test", t)
+	testRequirementSuccess(uhttp.R{"test": uhttp.STRING.MaxLen(3)}, map[string]string{"test": "abc"}, "test", "abc", t)
+	testRequirementFail(uhttp.R{"test": uhttp.STRING.MaxLen(3)}, map[string]string{"test": "abcd"}, "test", t)
+	testRequirementFail(uhttp.R{"test": uhttp.STRING.MinLen(3)}, map[string]string{"test": "ab"}, "test", t)
+	testRequirementSuccess(uhttp.R{"test": uhttp.STRING.Pattern(regexp.MustCompile("^[a-z]+$"))}, map[string]string{"test": "abc"}, "test", "abc", t)
+	testRequirementFail(uhttp.R{"test": uhttp.STRING.Pattern(regexp.MustCompile("^[a-z]+$"))}, map[string]string{"test": "ABC"}, "test", t)
+	testRequirementSuccess(uhttp.R{"test": uhttp.INT.Default("5")}, map[string]string{}, "test", 5, t)
+
+	u := uhttp.NewUHTTP()
+	err := u.ValidateParams(uhttp.R{"limit": uhttp.INT.Min(1).Max(100)}, map[string]string{"limit": "150"}, uhttp.R{}, true)
+	require.ErrorContains(t, err, "param limit: constraint max(100) failed, got 150")
+}
+
+func TestConstrainedParamsModel(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	handler := uhttp.NewHandler(
+		uhttp.WithParamsModel(struct {
+			Limit int      `query:"limit" min:"1" max:"100" default:"10"`
+			Query string   `query:"q" maxLen:"5" pattern:"^[a-z]+$"`
+			IDs   []testID `query:"id"`
+		}{}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]interface{}{
+				"limit": uhttp.GetAsInt("limit", r),
+				"q":     uhttp.GetAsString("q", r),
+				"id":    len(*uhttp.GetAs[[]testID]("id", r)),
+			}
+		}),
+	)
+	u.Handle("/test", handler)
+	RequireHTTPBodyJSONEq(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{
+		"q":  []string{"abc"},
+		"id": []string{"a-1", "b-2"},
+	}, `{"limit": 10, "q": "abc", "id": 2}`)
+	require.HTTPStatusCode(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{"limit": []string{"101"}}, http.StatusBadRequest)
+	require.HTTPStatusCode(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{"q": []string{"abcdef"}}, http.StatusBadRequest)
+	require.HTTPStatusCode(t, u.ServeMux().ServeHTTP, http.MethodGet, "/test", url.Values{"q": []string{"ABC"}}, http.StatusBadRequest)
+}
+
+func TestHeaderAndCookieParams(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	handler := uhttp.NewHandler(
+		uhttp.WithRequiredHeader(uhttp.R{"x-tenant": uhttp.STRING}),
+		uhttp.WithOptionalHeader(uhttp.R{"If-Match": uhttp.STRING}),
+		uhttp.WithRequiredCookie(uhttp.R{"theme": uhttp.ENUM("dark", "light")}),
+		uhttp.WithOptionalCookie(uhttp.R{"fontSize": uhttp.INT}),
+		uhttp.WithParamsModel(struct {
+			Language string `header:"Accept-Language" default:"en"`
+			FontSize *int   `cookie:"fontSize"`
+		}{}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]interface{}{
+				"tenant":   uhttp.GetHeaderAs[string]("x-tenant", r),
+				"ifMatch":  uhttp.GetHeaderAs[string]("If-Match", r),
+				"language": uhttp.GetHeaderAs[string]("Accept-Language", r),
+				"theme":    uhttp.GetCookieAs[string]("theme", r),
+				"fontSize": uhttp.GetCookieAs[int]("fontSize", r),
+			}
+		}),
+	)
+	u.Handle("/test", handler)
+
+	statusCode, body, _, _ := Run(t, u, http.MethodGet, "/test", map[string]string{
+		"X-Tenant": "tenant1",
+		"Cookie":   "theme=dark; fontSize=12",
+	})
+	require.Equal(t, http.StatusOK, statusCode)
+	require.JSONEq(t, `{"tenant": "tenant1", "ifMatch": null, "language": "en", "theme": "dark", "fontSize": 12}`, body)
+
+	statusCode, _, _, _ = Run(t, u, http.MethodGet, "/test", map[string]string{"Cookie": "theme=dark"})
+	require.Equal(t, http.StatusBadRequest, statusCode)
+
+	statusCode, _, _, _ = Run(t, u, http.MethodGet, "/test", map[string]string{"X-Tenant": "tenant1", "Cookie": "theme=blue"})
+	require.Equal(t, http.StatusBadRequest, statusCode)
+}
+
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Infof(template string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(template, args...))
+}
+
+func (l *testLogger) Errorf(template string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(template, args...))
+}
+
+func TestParamsInAccessLog(t *testing.T) {
+	logger := &testLogger{}
+	u := uhttp.NewUHTTP(uhttp.WithLogger(logger))
+	handler := uhttp.NewHandler(
+		uhttp.WithRequiredGet(uhttp.R{"id": uhttp.INT}),
+		uhttp.WithRequiredHeader(uhttp.R{"X-Tenant": uhttp.STRING}),
+		uhttp.WithRequiredCookie(uhttp.R{"theme": uhttp.STRING}),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]string{}
+		}),
+	)
+	u.Handle("/test", handler)
+
+	statusCode, _, _, _ := Run(t, u, http.MethodGet, "/test?id=1", map[string]string{"X-Tenant": "tenant1", "Cookie": "theme=dark"})
+	require.Equal(t, http.StatusOK, statusCode)
+	accessLog := logger.lines[len(logger.lines)-1]
+	require.Contains(t, accessLog, "[urlParam-id: 1]")
+	require.Contains(t, accessLog, "[headerParam-X-Tenant: tenant1]")
+	require.Contains(t, accessLog, "[cookieParam-theme: dark]")
+}
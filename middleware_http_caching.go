@@ -0,0 +1,89 @@
+package uhttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP caching policy of a handler (validators and Cache-Control of its responses)
+type httpCachingPolicy struct {
+	etag         ETagMode
+	cacheControl string
+	// only cached handlers have a meaningful Last-Modified and a derived Cache-Control
+	cached               bool
+	maxAge               time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+}
+
+// attaches the handler's HTTP caching policy to the context (it is applied when rendering)
+func httpCachingMiddleware(_ *UHTTP, opts handlerOptions) Middleware {
+	policy := &httpCachingPolicy{
+		etag:                 opts.etagMode,
+		cacheControl:         opts.cacheControl,
+		cached:               opts.cacheEnable,
+		maxAge:               opts.cacheMaxAge,
+		staleWhileRevalidate: opts.cacheStaleWhileRevalidate,
+		staleIfError:         opts.cacheStaleIfError,
+	}
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), CtxKeyHTTPCaching, policy)))
+		}
+	}
+}
+
+func getHTTPCachingPolicy(r *http.Request) *httpCachingPolicy {
+	if policy, ok := r.Context().Value(CtxKeyHTTPCaching).(*httpCachingPolicy); ok {
+		return policy
+	}
+	return nil
+}
+
+// apply sets the validators and Cache-Control for a rendered body (JSON without the trailing newline)
+// it returns true if the client's copy is still valid and 304 should be sent instead
+// maxAge overrides the handler's maxAge (if it is not 0, see SetCacheTTL)
+func (p *httpCachingPolicy) apply(w http.ResponseWriter, r *http.Request, statusCode int, encoding string, body []byte, lastModified time.Time, maxAge time.Duration) bool {
+	if p == nil || statusCode != http.StatusOK || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+
+	if cacheControl := p.cacheControlFor(lastModified, maxAge); cacheControl != "" {
+		w.Header().Set(HEADER_CACHE_CONTROL, cacheControl)
+	}
+
+	etag := ""
+	if p.etag != ETAG_DISABLED {
+		etag = formatETag(contentHash(body), p.etag, encoding)
+		w.Header().Set(HEADER_ETAG, etag)
+	}
+
+	if !p.cached {
+		lastModified = time.Time{}
+	} else {
+		w.Header().Set(HEADER_LAST_MODIFIED, lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	return notModified(r, etag, lastModified)
+}
+
+func (p *httpCachingPolicy) cacheControlFor(lastModified time.Time, maxAge time.Duration) string {
+	if p.cacheControl != "" || !p.cached {
+		return p.cacheControl
+	}
+	if maxAge == 0 {
+		maxAge = p.maxAge
+	}
+	remaining := max(maxAge-time.Since(lastModified), 0)
+	directives := []string{fmt.Sprintf("max-age=%d", int(remaining.Round(time.Second).Seconds()))}
+	if p.staleWhileRevalidate > 0 {
+		directives = append(directives, fmt.Sprintf("stale-while-revalidate=%d", int(p.staleWhileRevalidate.Seconds())))
+	}
+	if p.staleIfError > 0 {
+		directives = append(directives, fmt.Sprintf("stale-if-error=%d", int(p.staleIfError.Seconds())))
+	}
+	return strings.Join(directives, ", ")
+}
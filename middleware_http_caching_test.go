@@ -0,0 +1,141 @@
+package uhttp_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dunv/uhttp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPCachingETag(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	model := "initial"
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]string{"model": model}
+		}),
+	))
+
+	statusCode, _, header, _ := Run(t, u, http.MethodGet, "/test", nil)
+	require.Equal(t, http.StatusOK, statusCode)
+	etag := header.Get(uhttp.HEADER_ETAG)
+	require.True(t, strings.HasPrefix(etag, `W/"`), etag)
+	// uncached handlers do not get caching-headers
+	require.Empty(t, header.Get(uhttp.HEADER_CACHE_CONTROL))
+	require.Empty(t, header.Get(uhttp.HEADER_LAST_MODIFIED))
+
+	// weak etags are the same for all encodings
+	statusCode, body, header, _ := Run(t, u, http.MethodGet, "/test", map[string]string{uhttp.HEADER_IF_NONE_MATCH: etag, "Accept-Encoding": "gzip"})
+	require.Equal(t, http.StatusNotModified, statusCode)
+	require.Empty(t, body)
+	require.Empty(t, header.Get(uhttp.HEADER_CONTENT_ENCODING))
+	require.Equal(t, etag, header.Get(uhttp.HEADER_ETAG))
+
+	statusCode, _, _, _ = Run(t, u, http.MethodGet, "/test", map[string]string{uhttp.HEADER_IF_NONE_MATCH: `"other", ` + etag})
+	require.Equal(t, http.StatusNotModified, statusCode)
+
+	model = "changed"
+	statusCode, body, header, _ = Run(t, u, http.MethodGet, "/test", map[string]string{uhttp.HEADER_IF_NONE_MATCH: etag})
+	require.Equal(t, http.StatusOK, statusCode)
+	require.JSONEq(t, `{"model": "changed"}`, body)
+	require.NotEqual(t, etag, header.Get(uhttp.HEADER_ETAG))
+}
+
+func TestHTTPCachingStrongETag(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithETag(uhttp.ETAG_STRONG),
+		uhttp.WithCompressionMinSize(0),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]string{"model": "ok"}
+		}),
+	))
+
+	_, _, plain, _ := Run(t, u, http.MethodGet, "/test", nil)
+	_, _, gzip, _ := Run(t, u, http.MethodGet, "/test", map[string]string{"Accept-Encoding": "gzip"})
+	require.False(t, strings.HasPrefix(plain.Get(uhttp.HEADER_ETAG), "W/"))
+	require.NotEqual(t, plain.Get(uhttp.HEADER_ETAG), gzip.Get(uhttp.HEADER_ETAG))
+
+	statusCode, _, _, _ := Run(t, u, http.MethodGet, "/test", map[string]string{uhttp.HEADER_IF_NONE_MATCH: gzip.Get(uhttp.HEADER_ETAG), "Accept-Encoding": "gzip"})
+	require.Equal(t, http.StatusNotModified, statusCode)
+}
+
+func TestHTTPCachingDisabled(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithETag(uhttp.ETAG_DISABLED),
+		uhttp.WithCacheControl("no-store"),
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			return map[string]string{"model": "ok"}
+		}),
+	))
+
+	statusCode, _, header, _ := Run(t, u, http.MethodGet, "/test", map[string]string{uhttp.HEADER_IF_NONE_MATCH: "*"})
+	require.Equal(t, http.StatusOK, statusCode)
+	require.Empty(t, header.Get(uhttp.HEADER_ETAG))
+	require.Equal(t, "no-store", header.Get(uhttp.HEADER_CACHE_CONTROL))
+}
+
+func TestHTTPCachingCachedHandler(t *testing.T) {
+	for _, persistEncodings := range []bool{false, true} {
+		u := uhttp.NewUHTTP()
+		counter := 0
+		opts := []uhttp.HandlerOption{
+			uhttp.WithCache(time.Minute),
+			uhttp.WithCacheStaleWhileRevalidate(10 * time.Second),
+			uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+				counter++
+				return map[string]string{"model": "ok"}
+			}),
+		}
+		if persistEncodings {
+			opts = append(opts, uhttp.WithCachePersistEncodings())
+		}
+		u.Handle("/test", uhttp.NewHandler(opts...))
+
+		statusCode, _, header, _ := Run(t, u, http.MethodGet, "/test", nil)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, "max-age=60, stale-while-revalidate=10", header.Get(uhttp.HEADER_CACHE_CONTROL))
+		etag := header.Get(uhttp.HEADER_ETAG)
+		lastModified := header.Get(uhttp.HEADER_LAST_MODIFIED)
+		require.NotEmpty(t, lastModified)
+
+		// cache-hits have the same validators
+		statusCode, _, header, _ = Run(t, u, http.MethodGet, "/test", nil)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, "true", header.Get(uhttp.CACHE_HEADER))
+		require.Equal(t, etag, header.Get(uhttp.HEADER_ETAG))
+
+		statusCode, _, _, _ = Run(t, u, http.MethodGet, "/test", map[string]string{uhttp.HEADER_IF_NONE_MATCH: etag})
+		require.Equal(t, http.StatusNotModified, statusCode)
+		statusCode, _, _, _ = Run(t, u, http.MethodGet, "/test", map[string]string{uhttp.HEADER_IF_MODIFIED_SINCE: lastModified})
+		require.Equal(t, http.StatusNotModified, statusCode)
+		statusCode, _, _, _ = Run(t, u, http.MethodGet, "/test", map[string]string{uhttp.HEADER_IF_MODIFIED_SINCE: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)})
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, 1, counter)
+	}
+}
+
+func TestHTTPCachingOnlySuccessfulGet(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	u.Handle("/test", uhttp.NewHandler(
+		uhttp.WithGet(func(r *http.Request, ret *int) interface{} {
+			*ret = http.StatusNotFound
+			return map[string]string{"error": "not found"}
+		}),
+		uhttp.WithPost(func(r *http.Request, ret *int) interface{} {
+			return map[string]string{"model": "ok"}
+		}),
+	))
+
+	statusCode, _, header, _ := Run(t, u, http.MethodGet, "/test", map[string]string{uhttp.HEADER_IF_NONE_MATCH: "*"})
+	require.Equal(t, http.StatusNotFound, statusCode)
+	require.Empty(t, header.Get(uhttp.HEADER_ETAG))
+
+	statusCode, _, header, _ = Run(t, u, http.MethodPost, "/test", map[string]string{uhttp.HEADER_IF_NONE_MATCH: "*"})
+	require.Equal(t, http.StatusOK, statusCode)
+	require.Empty(t, header.Get(uhttp.HEADER_ETAG))
+}
@@ -3,6 +3,7 @@ package uhttp
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,6 +12,21 @@ import (
 
 // ParseModel parses and adds a model from a requestbody if wanted
 func parseModelMiddleware(u *UHTTP, handlerOpts handlerOptions, postModel interface{}, getModel interface{}, deleteModel interface{}) func(next http.HandlerFunc) http.HandlerFunc {
+	// inspect the form-tags of struct-models only once, an invalid definition is a bug in the code
+	formFields := map[reflect.Type][]paramField{}
+	for _, model := range []interface{}{postModel, getModel, deleteModel} {
+		if model == nil || reflect.TypeOf(model).Kind() != reflect.Struct {
+			continue
+		}
+		fields, err := paramFieldsFromModel(model, TAG_FORM)
+		if err != nil {
+			err = fmt.Errorf("invalid model for handler %s (%s)", handlerOpts.handlerPattern, err)
+			u.Log().Errorf("%s", err)
+			panic(err)
+		}
+		formFields[reflect.TypeOf(model)] = fields
+	}
+
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			var reflectModel reflect.Value
@@ -26,6 +42,27 @@ func parseModelMiddleware(u *UHTTP, handlerOpts handlerOptions, postModel interf
 				doParsing = true
 			}
 
+			if doParsing && isContentType(r, CONTENT_TYPE_MULTIPART_FORM) {
+				// multipart bodies are streamed (files can be large), the body is not available afterwards
+				modelInterface := reflectModel.Interface()
+				files, err := decodeMultipartRequestBody(r, handlerOpts, modelInterface, formFields[reflectModel.Type().Elem()])
+				defer files.remove()
+				if err != nil {
+					statusCode := http.StatusBadRequest
+					if errors.Is(err, errUploadTooLarge) {
+						statusCode = http.StatusRequestEntityTooLarge
+					}
+					u.RenderErrorWithStatusCode(w, r, statusCode, fmt.Errorf("Could not decode request body (%s)", err), false)
+					u.opts.logParseModelError("parseModelError [path: %s] Could not decode request body %s", r.RequestURI, err.Error())
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), CtxKeyPostModel, modelInterface)
+				ctx = context.WithValue(ctx, CtxKeyUploadedFiles, files)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			if doParsing {
 				// Save body
 				var bodyBytes []byte
@@ -50,7 +87,7 @@ func parseModelMiddleware(u *UHTTP, handlerOpts handlerOptions, postModel interf
 
 				// Parse body
 				modelInterface := reflectModel.Interface()
-				err := decodeRequestBody(r, modelInterface)
+				err := decodeRequestBody(r, modelInterface, formFields[reflectModel.Type().Elem()])
 				if err != nil {
 					u.RenderErrorWithStatusCode(w, r, http.StatusBadRequest, fmt.Errorf("Could not decode request body (%s)", err), false)
 					u.opts.logParseModelError("parseModelError [path: %s] Could not decode request body %s", r.RequestURI, err.Error())
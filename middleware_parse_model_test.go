@@ -1,10 +1,18 @@
 package uhttp_test
 
 import (
+	"bytes"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/dunv/uhttp"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParsePostModel(t *testing.T) {
@@ -51,3 +59,200 @@ func TestParseDeleteModel(t *testing.T) {
 
 	executeHandler(handler, http.MethodDelete, http.StatusOK, requestBody, expectedResponseBody, u, t)
 }
+
+type testFormModel struct {
+	Name  string                `form:"name" required:"true"`
+	Count int                   `form:"count" default:"1"`
+	Tags  []string              `form:"tag"`
+	File  *uhttp.UploadedFile   `form:"file"`
+	Files []*uhttp.UploadedFile `form:"files"`
+}
+
+func testMultipartRequest(t *testing.T, values url.Values, files map[string]string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, keyValues := range values {
+		for _, value := range keyValues {
+			require.NoError(t, writer.WriteField(key, value))
+		}
+	}
+	for key, content := range files {
+		part, err := writer.CreateFormFile(key, key+".txt")
+		require.NoError(t, err)
+		_, err = part.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestParseFormModel(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	handler := uhttp.NewHandler(uhttp.WithPostModel(
+		testFormModel{},
+		func(r *http.Request, model interface{}, ret *int) interface{} {
+			parsed := model.(*testFormModel)
+			return map[string]interface{}{"name": parsed.Name, "count": parsed.Count, "tags": parsed.Tags}
+		},
+	))
+
+	body := url.Values{"name": {"test"}, "tag": {"a", "b"}}.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.HandlerFunc(u).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"name":"test","count":1,"tags":["a","b"]}`, w.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("count=2"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	handler.HandlerFunc(u).ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "required param name")
+}
+
+func TestParseFormModelInvalidDefinition(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	require.Panics(t, func() {
+		u.Handle("/test", uhttp.NewHandler(uhttp.WithPostModel(
+			struct {
+				Date int `form:"date" format:"shortDate"`
+			}{},
+			func(r *http.Request, model interface{}, ret *int) interface{} { return nil },
+		)))
+	})
+}
+
+func TestParseFormMapModel(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	handler := uhttp.NewHandler(uhttp.WithPostModel(
+		map[string]string{},
+		func(r *http.Request, model interface{}, ret *int) interface{} {
+			return model
+		},
+	))
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("test=test"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	w := httptest.NewRecorder()
+	handler.HandlerFunc(u).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"test":"test"}`, w.Body.String())
+}
+
+func TestParseMultipartModel(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	handler := uhttp.NewHandler(uhttp.WithPostModel(
+		testFormModel{},
+		func(r *http.Request, model interface{}, ret *int) interface{} {
+			parsed := model.(*testFormModel)
+			reader, err := parsed.File.Open()
+			require.NoError(t, err)
+			defer reader.Close()
+			content, err := io.ReadAll(reader)
+			require.NoError(t, err)
+
+			require.Equal(t, parsed.File, uhttp.GetUploadedFile("file", r))
+			return map[string]interface{}{
+				"name":        parsed.Name,
+				"fileName":    parsed.File.FileName,
+				"size":        parsed.File.Size,
+				"contentType": parsed.File.ContentType,
+				"content":     string(content),
+				"files":       len(parsed.Files),
+			}
+		},
+	))
+
+	req := testMultipartRequest(t, url.Values{"name": {"test"}}, map[string]string{"file": "hello"})
+	w := httptest.NewRecorder()
+	handler.HandlerFunc(u).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{
+		"name": "test",
+		"fileName": "file.txt",
+		"size": 5,
+		"contentType": "text/plain; charset=utf-8",
+		"content": "hello",
+		"files": 0
+	}`, w.Body.String())
+}
+
+func TestParseMultipartModelDebugRawRequestBody(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	var rawBody []byte
+	handler := uhttp.NewHandler(
+		uhttp.WithDebugRawRequestBody(func(body []byte) { rawBody = body }),
+		uhttp.WithPostModel(testFormModel{}, func(r *http.Request, model interface{}, ret *int) interface{} {
+			return nil
+		}),
+	)
+
+	req := testMultipartRequest(t, url.Values{"name": {"test"}, "tag": {"a"}}, map[string]string{"file": "hello"})
+	w := httptest.NewRecorder()
+	handler.HandlerFunc(u).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "name=test&tag=a", string(rawBody))
+}
+
+func TestParseMultipartModelTempFile(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	tempDir := t.TempDir()
+	content := strings.Repeat("a", 100)
+
+	var path string
+	handler := uhttp.NewHandler(
+		uhttp.WithUploadStorage(tempDir, 10),
+		uhttp.WithPostModel(
+			testFormModel{},
+			func(r *http.Request, model interface{}, ret *int) interface{} {
+				parsed := model.(*testFormModel)
+				path = parsed.File.Path()
+				require.NotEmpty(t, path)
+				stored, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.Equal(t, content, string(stored))
+				return map[string]interface{}{"size": parsed.File.Size}
+			},
+		),
+	)
+
+	req := testMultipartRequest(t, url.Values{"name": {"test"}}, map[string]string{"file": content})
+	w := httptest.NewRecorder()
+	handler.HandlerFunc(u).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"size":100}`, w.Body.String())
+
+	// temporary files are removed after the request
+	_, err := os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestParseMultipartModelTooLarge(t *testing.T) {
+	u := uhttp.NewUHTTP()
+	handler := uhttp.NewHandler(
+		uhttp.WithUploadLimits(10, 15),
+		uhttp.WithPostModel(
+			testFormModel{},
+			func(r *http.Request, model interface{}, ret *int) interface{} {
+				return map[string]string{}
+			},
+		),
+	)
+
+	req := testMultipartRequest(t, url.Values{"name": {"test"}}, map[string]string{"file": strings.Repeat("a", 11)})
+	w := httptest.NewRecorder()
+	handler.HandlerFunc(u).ServeHTTP(w, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	require.Contains(t, w.Body.String(), "max 10 bytes per file")
+
+	req = testMultipartRequest(t, url.Values{"name": {"test"}}, map[string]string{"file": "aaaaaaa", "files": "aaaaaaa"})
+	w = httptest.NewRecorder()
+	handler.HandlerFunc(u).ServeHTTP(w, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	require.Contains(t, w.Body.String(), "max 15 bytes in total")
+}
@@ -2,61 +2,127 @@ package uhttp
 
 import (
 	"fmt"
+	"net/url"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dunv/uhelpers"
 )
 
 const (
-	STRING       string = "string"
-	BOOL         string = "bool"
-	INT          string = "int"
-	INT32        string = "int32"
-	INT64        string = "int64"
-	FLOAT32      string = "float32"
-	FLOAT64      string = "float64"
-	SHORT_DATE   string = "shortDate" // 2006-01-02
-	RFC3339_DATE string = "rfc3339Date"
-	DURATION     string = "duration"
+	STRING       ParamType = "string"
+	BOOL         ParamType = "bool"
+	INT          ParamType = "int"
+	INT32        ParamType = "int32"
+	INT64        ParamType = "int64"
+	FLOAT32      ParamType = "float32"
+	FLOAT64      ParamType = "float64"
+	SHORT_DATE   ParamType = "shortDate" // 2006-01-02
+	RFC3339_DATE ParamType = "rfc3339Date"
+	DURATION     ParamType = "duration"
 )
 
 func ENUM(values ...string) []string {
 	return values
 }
 
+// A param which can be given multiple times (?id=1&id=2) or as comma-separated values (?id=1,2)
+// e.g. LIST(INT), LIST(ENUM("open", "closed")).Min(1).Max(10)
+type ListRequirement struct {
+	requirement interface{}
+	min         int
+	max         int
+}
+
+func LIST(requirement interface{}) ListRequirement {
+	return ListRequirement{requirement: requirement}
+}
+
+// Min number of values which need to be present
+func (l ListRequirement) Min(min int) ListRequirement {
+	l.min = min
+	return l
+}
+
+// Max number of values which may be present (0 means unlimited)
+func (l ListRequirement) Max(max int) ListRequirement {
+	l.max = max
+	return l
+}
+
+func (l ListRequirement) String() string {
+	return fmt.Sprintf("[]%v", l.requirement)
+}
+
 type R map[string]interface{}
 
 func (r R) Printable() (map[string]string, error) {
 	printable := map[string]string{}
 	for key, value := range r {
-		switch typed := value.(type) {
-		case string:
-			printable[key] = typed
-		case bool:
-			printable[key] = strconv.FormatBool(typed)
-		case int:
-			printable[key] = strconv.FormatInt(int64(typed), 10)
-		case int32:
-			printable[key] = strconv.FormatInt(int64(typed), 10)
-		case int64:
-			printable[key] = strconv.FormatInt(typed, 10)
-		case float32:
-			printable[key] = strconv.FormatFloat(float64(typed), 'f', 2, 32)
-		case float64:
-			printable[key] = strconv.FormatFloat(typed, 'f', 2, 64)
-		case time.Time:
-			printable[key] = typed.Format(time.RFC3339)
-		case time.Duration:
-			printable[key] = typed.String()
-		default:
-			return nil, fmt.Errorf("could not print type %T", typed)
+		printableValue, err := printableParam(value)
+		if err != nil {
+			return nil, err
 		}
+		printable[key] = printableValue
 	}
 	return printable, nil
 }
 
+func printableParam(value interface{}) (string, error) {
+	switch typed := value.(type) {
+	case string:
+		return typed, nil
+	case bool:
+		return strconv.FormatBool(typed), nil
+	case int:
+		return strconv.FormatInt(int64(typed), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(typed), 10), nil
+	case int64:
+		return strconv.FormatInt(typed, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(typed), 'f', 2, 32), nil
+	case float64:
+		return strconv.FormatFloat(typed, 'f', 2, 64), nil
+	case time.Time:
+		return typed.Format(time.RFC3339), nil
+	case time.Duration:
+		return typed.String(), nil
+	case fmt.Stringer:
+		// custom param types
+		return typed.String(), nil
+	}
+
+	// lists are printed comma-separated
+	if reflected := reflect.ValueOf(value); reflected.Kind() == reflect.Slice {
+		printableValues := make([]string, reflected.Len())
+		for i := 0; i < reflected.Len(); i++ {
+			printableValue, err := printableParam(reflected.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			printableValues[i] = printableValue
+		}
+		return strings.Join(printableValues, ","), nil
+	}
+
+	return "", fmt.Errorf("could not print type %T", value)
+}
+
+// ValidateParams parses actual into destination, absent params are an error if required is set
+// (otherwise they are skipped), invalid values are always an error
 func (u *UHTTP) ValidateParams(requirement R, actual map[string]string, destination R, required bool) error {
+	actualValues := url.Values{}
+	for key, value := range actual {
+		actualValues.Set(key, value)
+	}
+	return u.ValidateParamValues(requirement, actualValues, destination, required)
+}
+
+// Same as ValidateParams, but supports params which are given multiple times (only allowed for LIST requirements)
+func (u *UHTTP) ValidateParamValues(requirement R, actual url.Values, destination R, required bool) error {
 	errors := []error{}
 	keys := uhelpers.KeysFromMap(requirement)
 	for _, key := range keys {
@@ -66,50 +132,75 @@ func (u *UHTTP) ValidateParams(requirement R, actual map[string]string, destinat
 			u.opts.log.Errorf("key %s already present when parsing more params, check the requirements in the handler's definition", key)
 		}
 
-		// var actualValue string
-		// var ok bool
-		if _, ok := actual[key]; !ok && required {
-			errors = append(errors, fmt.Errorf("required param %s (%s) not present", key, requirement[key]))
-			continue
-		}
-
-		switch requirement[key].(type) {
-		case string:
-			switch requirement[key] {
-			case STRING:
-				parseString(actual[key], key, destination, &errors)
-			case BOOL:
-				parseBool(actual[key], key, destination, &errors)
-			case INT:
-				parseInt(actual[key], key, 0, destination, &errors)
-			case INT32:
-				parseInt(actual[key], key, 32, destination, &errors)
-			case INT64:
-				parseInt(actual[key], key, 64, destination, &errors)
-			case FLOAT32:
-				parseFloat(actual[key], key, 32, destination, &errors)
-			case FLOAT64:
-				parseFloat(actual[key], key, 64, destination, &errors)
-			case SHORT_DATE:
-				parseDate(actual[key], key, "2006-01-02", destination, &errors)
-			case RFC3339_DATE:
-				parseDate(actual[key], key, time.RFC3339, destination, &errors)
-			case DURATION:
-				parseDuration(actual[key], key, destination, &errors)
-			default:
-				return fmt.Errorf("unknown param requirement")
+		values, ok := actual[key]
+		if !ok {
+			if defaultValue, hasDefault := paramDefault(requirement[key]); hasDefault {
+				values = []string{defaultValue}
+			} else if required {
+				errors = append(errors, fmt.Errorf("required param %s (%s) not present", key, requirement[key]))
+				continue
+			} else {
+				// absent optional params are not parsed (a custom parser could produce a value otherwise)
+				continue
 			}
-		case []string:
-			parseEnum(actual[key], requirement[key].([]string), key, destination, &errors)
-		default:
-			errors = append(errors, fmt.Errorf("don't know what to do with %+v \n", requirement[key]))
 		}
 
+		if err := parseParam(requirement[key], values, key, destination, &errors); err != nil {
+			return err
+		}
 	}
 
-	if required && len(errors) != 0 {
+	// optional params are validated as well if they are present
+	if len(errors) != 0 {
 		return fmt.Errorf("could not parse %v", errors)
 	}
 
 	return nil
 }
+
+// parseParam parses the value(s) of a param according to its requirement and adds it to the validatedMap
+// an error is only returned if the requirement itself is unknown
+func parseParam(requirement interface{}, values []string, key string, validatedMap R, errors *[]error) error {
+	if list, ok := requirement.(ListRequirement); ok {
+		return parseList(values, list, key, validatedMap, errors)
+	}
+
+	if len(values) > 1 {
+		*errors = append(*errors, fmt.Errorf("param %s has more than one value (given multiple times), this is not supported", key))
+		return nil
+	}
+
+	var value string
+	if len(values) == 1 {
+		value = values[0]
+	}
+
+	if enum, ok := requirement.([]string); ok {
+		parsed, err := parseEnum(value, enum)
+		if err != nil {
+			*errors = append(*errors, fmt.Errorf("param %s: %s", key, err))
+			return nil
+		}
+		validatedMap[key] = parsed
+		return nil
+	}
+
+	paramRequirement, ok := toParamRequirement(requirement)
+	if !ok {
+		*errors = append(*errors, fmt.Errorf("don't know what to do with %+v \n", requirement))
+		return nil
+	}
+
+	definition, ok := lookupParamType(paramRequirement.paramType)
+	if !ok {
+		return fmt.Errorf("unknown param requirement %s", paramRequirement.paramType)
+	}
+
+	parsed, err := paramRequirement.parse(definition, value, key)
+	if err != nil {
+		*errors = append(*errors, err)
+		return nil
+	}
+	validatedMap[key] = parsed
+	return nil
+}
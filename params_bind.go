@@ -0,0 +1,335 @@
+package uhttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct-tags which are evaluated when binding params into a model (see WithParamsModel)
+//
+//	type listParams struct {
+//		From   time.Time  `query:"from" required:"true" format:"shortDate"`
+//		Limit  int        `query:"limit" default:"100"`
+//		Status *string    `query:"status" enum:"open,closed"`
+//		IDs    []int      `query:"id" minItems:"1" maxItems:"10" min:"1"`
+//		Search string     `query:"q" maxLen:"50" pattern:"^[a-z]+$"`
+//		Tenant string     `header:"X-Tenant" required:"true"`
+//		Theme  *string    `cookie:"theme"`
+//	}
+//
+// Models which are parsed from form-encoded request-bodies use the form-tag (see decodeFormRequestBody)
+const (
+	TAG_QUERY     = "query"
+	TAG_HEADER    = "header"
+	TAG_COOKIE    = "cookie"
+	TAG_FORM      = "form"
+	TAG_REQUIRED  = "required"
+	TAG_DEFAULT   = "default"
+	TAG_FORMAT    = "format"
+	TAG_ENUM      = "enum"
+	TAG_MIN_ITEMS = "minItems"
+	TAG_MAX_ITEMS = "maxItems"
+	TAG_MIN       = "min"
+	TAG_MAX       = "max"
+	TAG_MIN_LEN   = "minLen"
+	TAG_MAX_LEN   = "maxLen"
+	TAG_PATTERN   = "pattern"
+)
+
+// description of a single field of a params-model
+type paramField struct {
+	index        []int
+	source       string // one of TAG_QUERY, TAG_HEADER, TAG_COOKIE, TAG_FORM
+	key          string
+	requirement  interface{}
+	required     bool
+	defaultValue *string
+	isPointer    bool
+	isFile       bool // *UploadedFile or []*UploadedFile, only for TAG_FORM
+}
+
+var uploadedFileType = reflect.TypeOf(&UploadedFile{})
+
+// paramFieldsFromModel inspects the struct-tags (of the given sources) of a model once (when the handler is created)
+func paramFieldsFromModel(model interface{}, sources ...string) ([]paramField, error) {
+	modelType := reflect.TypeOf(model)
+	if modelType == nil || modelType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("model needs to be a struct, got %T", model)
+	}
+
+	fields := []paramField{}
+	for i := 0; i < modelType.NumField(); i++ {
+		structField := modelType.Field(i)
+		var source, key string
+		for _, tag := range sources {
+			if value, ok := structField.Tag.Lookup(tag); ok && value != "-" {
+				source, key = tag, value
+				break
+			}
+		}
+		if source == "" {
+			continue
+		}
+		if !structField.IsExported() {
+			return nil, fmt.Errorf("field %s of model is not exported", structField.Name)
+		}
+
+		field := paramField{
+			index:    structField.Index,
+			source:   source,
+			key:      key,
+			required: structField.Tag.Get(TAG_REQUIRED) == "true",
+		}
+
+		// uploaded files are not parsed, they are assigned as they are
+		if source == TAG_FORM && (structField.Type == uploadedFileType || structField.Type == reflect.SliceOf(uploadedFileType)) {
+			field.isFile = true
+			fields = append(fields, field)
+			continue
+		}
+
+		fieldType := structField.Type
+		if fieldType.Kind() == reflect.Pointer {
+			field.isPointer = true
+			fieldType = fieldType.Elem()
+		}
+
+		// slices are bound as lists, the remaining tags apply to each element
+		isList := fieldType.Kind() == reflect.Slice && !field.isPointer
+		if isList {
+			fieldType = fieldType.Elem()
+		}
+
+		requirement, err := paramRequirementForField(fieldType, structField.Tag)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of model: %s", structField.Name, err)
+		}
+
+		if isList {
+			list := LIST(requirement)
+			if list.min, err = intTag(structField.Tag, TAG_MIN_ITEMS); err != nil {
+				return nil, fmt.Errorf("field %s of model: %s", structField.Name, err)
+			}
+			if list.max, err = intTag(structField.Tag, TAG_MAX_ITEMS); err != nil {
+				return nil, fmt.Errorf("field %s of model: %s", structField.Name, err)
+			}
+			requirement = list
+		}
+		field.requirement = requirement
+
+		if defaultValue, ok := structField.Tag.Lookup(TAG_DEFAULT); ok {
+			// make sure a default can actually be parsed, otherwise it is a bug in the handler's definition
+			errs := []error{}
+			if err := parseParam(requirement, []string{defaultValue}, key, R{}, &errs); err != nil {
+				return nil, fmt.Errorf("field %s of model: %s", structField.Name, err)
+			}
+			if len(errs) != 0 {
+				return nil, fmt.Errorf("field %s of model: invalid default (%v)", structField.Name, errs)
+			}
+			field.defaultValue = &defaultValue
+		}
+
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// paramRequirementForField derives the requirement from the field's type, its format- or enum-tag
+// and the constraint-tags
+func paramRequirementForField(fieldType reflect.Type, tag reflect.StructTag) (interface{}, error) {
+	if enum, ok := tag.Lookup(TAG_ENUM); ok {
+		if fieldType.Kind() != reflect.String {
+			return nil, fmt.Errorf("enum can only be bound to a string, got %s", fieldType)
+		}
+		return ENUM(strings.Split(enum, ",")...), nil
+	}
+
+	var paramType ParamType
+	if format, ok := tag.Lookup(TAG_FORMAT); ok {
+		definition, ok := lookupParamType(ParamType(format))
+		if !ok {
+			return nil, fmt.Errorf("unknown format %s", format)
+		}
+		if definition.valueType != fieldType {
+			return nil, fmt.Errorf("format %s cannot be bound to %s", format, fieldType)
+		}
+		paramType = ParamType(format)
+	} else {
+		var err error
+		if paramType, err = paramTypeForFieldType(fieldType); err != nil {
+			return nil, err
+		}
+	}
+
+	requirement := ParamRequirement{paramType: paramType}
+	for _, name := range []string{TAG_MIN, TAG_MAX} {
+		if value, ok := tag.Lookup(name); ok {
+			limit, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s (%s)", name, err)
+			}
+			if name == TAG_MIN {
+				requirement = requirement.Min(limit)
+			} else {
+				requirement = requirement.Max(limit)
+			}
+		}
+	}
+	for _, name := range []string{TAG_MIN_LEN, TAG_MAX_LEN} {
+		if _, ok := tag.Lookup(name); ok {
+			length, err := intTag(tag, name)
+			if err != nil {
+				return nil, err
+			}
+			if name == TAG_MIN_LEN {
+				requirement = requirement.MinLen(length)
+			} else {
+				requirement = requirement.MaxLen(length)
+			}
+		}
+	}
+	if pattern, ok := tag.Lookup(TAG_PATTERN); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s (%s)", TAG_PATTERN, err)
+		}
+		requirement = requirement.Pattern(re)
+	}
+	return requirement, nil
+}
+
+// paramTypeForFieldType finds the builtin type (or the registered custom type) which is parsed into fieldType
+func paramTypeForFieldType(fieldType reflect.Type) (ParamType, error) {
+	switch fieldType {
+	case reflect.TypeOf(time.Time{}):
+		return RFC3339_DATE, nil
+	case reflect.TypeOf(time.Duration(0)):
+		return DURATION, nil
+	}
+
+	for _, paramType := range []ParamType{STRING, BOOL, INT, INT32, INT64, FLOAT32, FLOAT64} {
+		if definition, ok := lookupParamType(paramType); ok && definition.valueType == fieldType {
+			return paramType, nil
+		}
+	}
+
+	paramTypesLock.RLock()
+	defer paramTypesLock.RUnlock()
+	candidates := []ParamType{}
+	for paramType, definition := range paramTypes {
+		if definition.valueType == fieldType {
+			candidates = append(candidates, paramType)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("unsupported type %s", fieldType)
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("type %s is ambiguous (%v), specify the format", fieldType, candidates)
+	}
+}
+
+func intTag(tag reflect.StructTag, name string) (int, error) {
+	value, ok := tag.Lookup(name)
+	if !ok {
+		return 0, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s (%s)", name, err)
+	}
+	return parsed, nil
+}
+
+// bindParams creates a new instance of the model and populates it from the actual params (by source)
+// all parsed values are added to the validatedMap of their source as well (so they are logged and accessible using GetAs*)
+func bindParams(modelType reflect.Type, fields []paramField, actual map[string]url.Values, validated map[string]R) (interface{}, error) {
+	model := reflect.New(modelType)
+	if err := bindParamsInto(model, fields, actual, validated); err != nil {
+		return nil, err
+	}
+	return model.Interface(), nil
+}
+
+// bindParamsInto populates an existing model (pointer to struct), files are skipped
+func bindParamsInto(model reflect.Value, fields []paramField, actual map[string]url.Values, validated map[string]R) error {
+	errors := []error{}
+
+	for _, field := range fields {
+		if field.isFile {
+			continue
+		}
+
+		validatedMap := validated[field.source]
+		values, ok := actual[field.source][field.key]
+		if !ok {
+			if field.defaultValue == nil {
+				if field.required {
+					errors = append(errors, fmt.Errorf("required param %s (%s) not present", field.key, field.requirement))
+				}
+				continue
+			}
+			values = []string{*field.defaultValue}
+		}
+
+		fieldErrors := []error{}
+		if err := parseParam(field.requirement, values, field.key, validatedMap, &fieldErrors); err != nil {
+			return err
+		}
+		if len(fieldErrors) != 0 {
+			errors = append(errors, fieldErrors...)
+			continue
+		}
+
+		parsed := reflect.ValueOf(validatedMap[field.key])
+		target := model.Elem().FieldByIndex(field.index)
+		if field.isPointer {
+			ptr := reflect.New(target.Type().Elem())
+			ptr.Elem().Set(convertParam(parsed, ptr.Elem().Type()))
+			target.Set(ptr)
+		} else {
+			target.Set(convertParam(parsed, target.Type()))
+		}
+	}
+
+	if len(errors) != 0 {
+		return fmt.Errorf("could not parse %v", errors)
+	}
+
+	return nil
+}
+
+// convertParam converts a parsed value to named types of the model (e.g. type Status string with an enum-tag)
+// other types are identical already (see paramRequirementForField)
+func convertParam(parsed reflect.Value, targetType reflect.Type) reflect.Value {
+	if parsed.Type() == targetType {
+		return parsed
+	}
+	if parsed.Kind() == reflect.Slice {
+		converted := reflect.MakeSlice(targetType, parsed.Len(), parsed.Len())
+		for i := 0; i < parsed.Len(); i++ {
+			converted.Index(i).Set(parsed.Index(i).Convert(targetType.Elem()))
+		}
+		return converted
+	}
+	return parsed.Convert(targetType)
+}
+
+// GetParamsModel returns a pointer to the model which was populated from the request's params
+// (only present if the handler was defined with WithParamsModel)
+func GetParamsModel(r *http.Request) interface{} {
+	return GetParamsModelFromContext(r.Context())
+}
+
+func GetParamsModelFromContext(ctx context.Context) interface{} {
+	return ctx.Value(CtxKeyParamsModel)
+}
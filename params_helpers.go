@@ -2,6 +2,7 @@ package uhttp
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 )
@@ -172,3 +173,132 @@ func GetAsDurationFromContext(key string, ctx context.Context) *time.Duration {
 
 	return &value
 }
+
+// Accessors for LIST requirements: return nil if the param is not present
+
+func getSliceFromContext[T any](key string, ctx context.Context) []T {
+	paramMap, ok := ctx.Value(CtxKeyGetParams).(R)
+	if !ok {
+		panic("ContextKeyGetParams is not present in the request's context. please check the handler's definition")
+	}
+
+	value, ok := paramMap[key].([]T)
+	if !ok {
+		return nil
+	}
+
+	return value
+}
+
+func GetAsStringSlice(key string, r *http.Request) []string {
+	return GetAsStringSliceFromContext(key, r.Context())
+}
+
+func GetAsStringSliceFromContext(key string, ctx context.Context) []string {
+	return getSliceFromContext[string](key, ctx)
+}
+
+func GetAsBoolSlice(key string, r *http.Request) []bool {
+	return GetAsBoolSliceFromContext(key, r.Context())
+}
+
+func GetAsBoolSliceFromContext(key string, ctx context.Context) []bool {
+	return getSliceFromContext[bool](key, ctx)
+}
+
+func GetAsIntSlice(key string, r *http.Request) []int {
+	return GetAsIntSliceFromContext(key, r.Context())
+}
+
+func GetAsIntSliceFromContext(key string, ctx context.Context) []int {
+	return getSliceFromContext[int](key, ctx)
+}
+
+func GetAsInt32Slice(key string, r *http.Request) []int32 {
+	return GetAsInt32SliceFromContext(key, r.Context())
+}
+
+func GetAsInt32SliceFromContext(key string, ctx context.Context) []int32 {
+	return getSliceFromContext[int32](key, ctx)
+}
+
+func GetAsInt64Slice(key string, r *http.Request) []int64 {
+	return GetAsInt64SliceFromContext(key, r.Context())
+}
+
+func GetAsInt64SliceFromContext(key string, ctx context.Context) []int64 {
+	return getSliceFromContext[int64](key, ctx)
+}
+
+func GetAsFloat32Slice(key string, r *http.Request) []float32 {
+	return GetAsFloat32SliceFromContext(key, r.Context())
+}
+
+func GetAsFloat32SliceFromContext(key string, ctx context.Context) []float32 {
+	return getSliceFromContext[float32](key, ctx)
+}
+
+func GetAsFloat64Slice(key string, r *http.Request) []float64 {
+	return GetAsFloat64SliceFromContext(key, r.Context())
+}
+
+func GetAsFloat64SliceFromContext(key string, ctx context.Context) []float64 {
+	return getSliceFromContext[float64](key, ctx)
+}
+
+func GetAsTimeSlice(key string, r *http.Request) []time.Time {
+	return GetAsTimeSliceFromContext(key, r.Context())
+}
+
+func GetAsTimeSliceFromContext(key string, ctx context.Context) []time.Time {
+	return getSliceFromContext[time.Time](key, ctx)
+}
+
+func GetAsDurationSlice(key string, r *http.Request) []time.Duration {
+	return GetAsDurationSliceFromContext(key, r.Context())
+}
+
+func GetAsDurationSliceFromContext(key string, ctx context.Context) []time.Duration {
+	return getSliceFromContext[time.Duration](key, ctx)
+}
+
+// Accessor for any param type, mainly for custom ones (see RegisterParamType): returns nil if the param is not present
+func GetAs[T any](key string, r *http.Request) *T {
+	return GetAsFromContext[T](key, r.Context())
+}
+
+func GetAsFromContext[T any](key string, ctx context.Context) *T {
+	return getParamFromContext[T](CtxKeyGetParams, key, ctx)
+}
+
+// Accessor for headers declared with WithRequiredHeader or WithOptionalHeader: returns nil if the header is not present
+func GetHeaderAs[T any](key string, r *http.Request) *T {
+	return GetHeaderAsFromContext[T](key, r.Context())
+}
+
+func GetHeaderAsFromContext[T any](key string, ctx context.Context) *T {
+	return getParamFromContext[T](CtxKeyHeaderParams, key, ctx)
+}
+
+// Accessor for cookies declared with WithRequiredCookie or WithOptionalCookie: returns nil if the cookie is not present
+func GetCookieAs[T any](key string, r *http.Request) *T {
+	return GetCookieAsFromContext[T](key, r.Context())
+}
+
+func GetCookieAsFromContext[T any](key string, ctx context.Context) *T {
+	return getParamFromContext[T](CtxKeyCookieParams, key, ctx)
+}
+
+func getParamFromContext[T any](ctxKey ContextKey, key string, ctx context.Context) *T {
+	paramMap, ok := ctx.Value(ctxKey).(R)
+	if !ok {
+		panic(fmt.Sprintf("%s is not present in the request's context. please check the handler's definition", ctxKey))
+	}
+
+	value, ok := paramMap[key].(T)
+	if !ok {
+		return nil
+	}
+
+	return &value
+}
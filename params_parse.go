@@ -2,85 +2,108 @@ package uhttp
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
 )
 
-func parseString(value string, key string, validatedMap R, errors *[]error) {
+func parseString(value string) (string, error) {
 	if value != "" {
-		validatedMap[key] = value
-		return
+		return value, nil
 	}
-	*errors = append(*errors, fmt.Errorf("could not validate string. needs to be not empty"))
+	return "", fmt.Errorf("could not validate string. needs to be not empty")
 }
 
-func parseEnum(value string, enum []string, key string, validatedMap R, errors *[]error) {
+func parseEnum(value string, enum []string) (string, error) {
 	for _, enumValue := range enum {
 		if enumValue == value {
-			validatedMap[key] = value
-			return
+			return value, nil
 		}
 	}
-	*errors = append(*errors, fmt.Errorf("could not validate enum. needs to be one of %s", enum))
+	return "", fmt.Errorf("could not validate enum. needs to be one of %s", enum)
 }
 
-func parseBool(value string, key string, validatedMap R, errors *[]error) {
+func parseBool(value string) (bool, error) {
 	if value == "true" {
-		validatedMap[key] = true
-		return
+		return true, nil
 	} else if value == "false" {
-		validatedMap[key] = false
-		return
+		return false, nil
 	}
-	*errors = append(*errors, fmt.Errorf("could not validate bool. needs to be true or false, got %s", value))
+	return false, fmt.Errorf("could not validate bool. needs to be true or false, got %s", value)
 }
 
-func parseInt(value string, key string, bits int, validatedMap R, errors *[]error) {
+func parseInt(value string, bits int) (int64, error) {
 	intValue, err := strconv.ParseInt(value, 10, 64)
 	if err != nil {
-		*errors = append(*errors, fmt.Errorf("could not validate int%d. got %s", bits, value))
-		return
-	}
-
-	switch bits {
-	case 0:
-		validatedMap[key] = int(intValue)
-	case 32:
-		validatedMap[key] = int32(intValue)
-	case 64:
-		validatedMap[key] = int64(intValue)
+		return 0, fmt.Errorf("could not validate int%d. got %s", bits, value)
 	}
+	return intValue, nil
 }
 
-func parseFloat(value string, key string, bits int, validatedMap R, errors *[]error) {
+func parseFloat(value string, bits int) (float64, error) {
 	floatValue, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		*errors = append(*errors, fmt.Errorf("could not validate float%d. got %s", bits, value))
-		return
-	}
-
-	switch bits {
-	case 32:
-		validatedMap[key] = float32(floatValue)
-	case 64:
-		validatedMap[key] = float64(floatValue)
+		return 0, fmt.Errorf("could not validate float%d. got %s", bits, value)
 	}
+	return floatValue, nil
 }
 
-func parseDate(value string, key string, format string, validatedMap R, errors *[]error) {
+func parseDate(value string, format string) (time.Time, error) {
 	parsedDate, err := time.Parse(format, value)
 	if err != nil {
-		*errors = append(*errors, fmt.Errorf("could not validate date (%s). got %s", format, value))
-		return
+		return time.Time{}, fmt.Errorf("could not validate date (%s). got %s", format, value)
 	}
-	validatedMap[key] = parsedDate
+	return parsedDate, nil
 }
 
-func parseDuration(value string, key string, validatedMap R, errors *[]error) {
+func parseDuration(value string) (time.Duration, error) {
 	parsedDuration, err := time.ParseDuration(value)
 	if err != nil {
-		*errors = append(*errors, fmt.Errorf("could not validate duration. got %s", value))
-		return
+		return 0, fmt.Errorf("could not validate duration. got %s", value)
+	}
+	return parsedDuration, nil
+}
+
+func parseList(values []string, list ListRequirement, key string, validatedMap R, errors *[]error) error {
+	elementType, err := paramRequirementType(list.requirement)
+	if err != nil {
+		return err
+	}
+
+	// absent optional lists are not stored (the accessors return nil)
+	if values == nil {
+		return nil
+	}
+
+	// support repeated keys as well as comma-separated values
+	elements := []string{}
+	for _, value := range values {
+		elements = append(elements, strings.Split(value, ",")...)
+	}
+
+	if len(elements) < list.min {
+		*errors = append(*errors, fmt.Errorf("param %s: could not validate list. needs at least %d values, got %d", key, list.min, len(elements)))
+		return nil
+	}
+	if list.max != 0 && len(elements) > list.max {
+		*errors = append(*errors, fmt.Errorf("param %s: could not validate list. needs at most %d values, got %d", key, list.max, len(elements)))
+		return nil
+	}
+
+	parsed := reflect.MakeSlice(reflect.SliceOf(elementType), 0, len(elements))
+	elementMap := R{}
+	elementErrors := []error{}
+	for _, element := range elements {
+		if err := parseParam(list.requirement, []string{element}, key, elementMap, &elementErrors); err != nil {
+			return err
+		}
+		if len(elementErrors) != 0 {
+			*errors = append(*errors, elementErrors...)
+			return nil
+		}
+		parsed = reflect.Append(parsed, reflect.ValueOf(elementMap[key]))
 	}
-	validatedMap[key] = parsedDuration
+	validatedMap[key] = parsed.Interface()
+	return nil
 }
@@ -0,0 +1,243 @@
+package uhttp
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Name of a param type, all builtin types (STRING, INT, ...) as well as custom ones
+// registered with RegisterParamType can be used in R directly or with constraints e.g. INT.Min(1).Max(100)
+type ParamType string
+
+type paramTypeDefinition struct {
+	parse     func(value string) (interface{}, error)
+	valueType reflect.Type
+}
+
+var (
+	paramTypes     = map[ParamType]paramTypeDefinition{}
+	paramTypesLock = &sync.RWMutex{}
+)
+
+func init() {
+	RegisterParamType(string(STRING), parseString)
+	RegisterParamType(string(BOOL), parseBool)
+	RegisterParamType(string(INT), func(value string) (int, error) {
+		parsed, err := parseInt(value, 0)
+		return int(parsed), err
+	})
+	RegisterParamType(string(INT32), func(value string) (int32, error) {
+		parsed, err := parseInt(value, 32)
+		return int32(parsed), err
+	})
+	RegisterParamType(string(INT64), func(value string) (int64, error) {
+		return parseInt(value, 64)
+	})
+	RegisterParamType(string(FLOAT32), func(value string) (float32, error) {
+		parsed, err := parseFloat(value, 32)
+		return float32(parsed), err
+	})
+	RegisterParamType(string(FLOAT64), func(value string) (float64, error) {
+		return parseFloat(value, 64)
+	})
+	RegisterParamType(string(SHORT_DATE), func(value string) (time.Time, error) {
+		return parseDate(value, "2006-01-02")
+	})
+	RegisterParamType(string(RFC3339_DATE), func(value string) (time.Time, error) {
+		return parseDate(value, time.RFC3339)
+	})
+	RegisterParamType(string(DURATION), parseDuration)
+}
+
+// RegisterParamType makes a custom type available for params (e.g. UUIDs, IPs or own IDs)
+// the parser's error is reported to the client, registering the same name twice panics
+//
+//	UUID := uhttp.RegisterParamType("uuid", uuid.Parse)
+//	uhttp.WithRequiredGet(uhttp.R{"id": UUID})
+func RegisterParamType[T any](name string, parser func(value string) (T, error)) ParamType {
+	paramTypesLock.Lock()
+	defer paramTypesLock.Unlock()
+
+	paramType := ParamType(name)
+	if _, ok := paramTypes[paramType]; ok {
+		panic(fmt.Sprintf("paramType %s is already registered", name))
+	}
+
+	paramTypes[paramType] = paramTypeDefinition{
+		parse: func(value string) (interface{}, error) {
+			return parser(value)
+		},
+		valueType: reflect.TypeOf((*T)(nil)).Elem(),
+	}
+	return paramType
+}
+
+func lookupParamType(paramType ParamType) (paramTypeDefinition, bool) {
+	paramTypesLock.RLock()
+	defer paramTypesLock.RUnlock()
+	definition, ok := paramTypes[paramType]
+	return definition, ok
+}
+
+func (t ParamType) Min(min float64) ParamRequirement {
+	return ParamRequirement{paramType: t}.Min(min)
+}
+
+func (t ParamType) Max(max float64) ParamRequirement {
+	return ParamRequirement{paramType: t}.Max(max)
+}
+
+func (t ParamType) MinLen(minLen int) ParamRequirement {
+	return ParamRequirement{paramType: t}.MinLen(minLen)
+}
+
+func (t ParamType) MaxLen(maxLen int) ParamRequirement {
+	return ParamRequirement{paramType: t}.MaxLen(maxLen)
+}
+
+func (t ParamType) Pattern(re *regexp.Regexp) ParamRequirement {
+	return ParamRequirement{paramType: t}.Pattern(re)
+}
+
+func (t ParamType) Default(value string) ParamRequirement {
+	return ParamRequirement{paramType: t}.Default(value)
+}
+
+// A ParamType with additional constraints which are checked after parsing
+type ParamRequirement struct {
+	paramType    ParamType
+	constraints  []paramConstraint
+	defaultValue *string
+}
+
+type paramConstraint struct {
+	name  string
+	check func(value interface{}) bool
+}
+
+func (p ParamRequirement) withConstraint(name string, check func(value interface{}) bool) ParamRequirement {
+	// copy, so requirements can be derived from one another
+	constraints := make([]paramConstraint, len(p.constraints), len(p.constraints)+1)
+	copy(constraints, p.constraints)
+	p.constraints = append(constraints, paramConstraint{name: name, check: check})
+	return p
+}
+
+// Min value (only for numeric types)
+func (p ParamRequirement) Min(min float64) ParamRequirement {
+	return p.withConstraint(fmt.Sprintf("min(%v)", min), func(value interface{}) bool {
+		numeric, ok := numericParam(value)
+		return ok && numeric >= min
+	})
+}
+
+// Max value (only for numeric types)
+func (p ParamRequirement) Max(max float64) ParamRequirement {
+	return p.withConstraint(fmt.Sprintf("max(%v)", max), func(value interface{}) bool {
+		numeric, ok := numericParam(value)
+		return ok && numeric <= max
+	})
+}
+
+// MinLen in characters (only for string types)
+func (p ParamRequirement) MinLen(minLen int) ParamRequirement {
+	return p.withConstraint(fmt.Sprintf("minLen(%d)", minLen), func(value interface{}) bool {
+		str, ok := value.(string)
+		return ok && utf8.RuneCountInString(str) >= minLen
+	})
+}
+
+// MaxLen in characters (only for string types)
+func (p ParamRequirement) MaxLen(maxLen int) ParamRequirement {
+	return p.withConstraint(fmt.Sprintf("maxLen(%d)", maxLen), func(value interface{}) bool {
+		str, ok := value.(string)
+		return ok && utf8.RuneCountInString(str) <= maxLen
+	})
+}
+
+// Pattern which needs to match (only for string types)
+func (p ParamRequirement) Pattern(re *regexp.Regexp) ParamRequirement {
+	return p.withConstraint(fmt.Sprintf("pattern(%s)", re), func(value interface{}) bool {
+		str, ok := value.(string)
+		return ok && re.MatchString(str)
+	})
+}
+
+// Default which is used if the param is not present (it is parsed and checked like an actual value)
+func (p ParamRequirement) Default(value string) ParamRequirement {
+	p.defaultValue = &value
+	return p
+}
+
+func (p ParamRequirement) String() string {
+	return string(p.paramType)
+}
+
+// parse a value with the definition of the requirement's type and check all constraints
+func (p ParamRequirement) parse(definition paramTypeDefinition, value string, key string) (interface{}, error) {
+	parsed, err := definition.parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("param %s: %s", key, err)
+	}
+
+	for _, constraint := range p.constraints {
+		if !constraint.check(parsed) {
+			return nil, fmt.Errorf("param %s: constraint %s failed, got %s", key, constraint.name, value)
+		}
+	}
+	return parsed, nil
+}
+
+func numericParam(value interface{}) (float64, bool) {
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(reflected.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(reflected.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return reflected.Float(), true
+	}
+	return 0, false
+}
+
+// toParamRequirement normalizes all non-list requirements
+func toParamRequirement(requirement interface{}) (ParamRequirement, bool) {
+	switch typed := requirement.(type) {
+	case ParamRequirement:
+		return typed, true
+	case ParamType:
+		return ParamRequirement{paramType: typed}, true
+	case string:
+		return ParamRequirement{paramType: ParamType(typed)}, true
+	}
+	return ParamRequirement{}, false
+}
+
+// paramRequirementType returns the go-type a (non-list) requirement is parsed into
+func paramRequirementType(requirement interface{}) (reflect.Type, error) {
+	if _, ok := requirement.([]string); ok {
+		return reflect.TypeOf(""), nil
+	}
+	paramRequirement, ok := toParamRequirement(requirement)
+	if !ok {
+		return nil, fmt.Errorf("don't know what to do with %+v", requirement)
+	}
+	definition, ok := lookupParamType(paramRequirement.paramType)
+	if !ok {
+		return nil, fmt.Errorf("unknown param requirement %s", paramRequirement.paramType)
+	}
+	return definition.valueType, nil
+}
+
+// paramDefault returns the default of a requirement (if any)
+func paramDefault(requirement interface{}) (string, bool) {
+	if paramRequirement, ok := requirement.(ParamRequirement); ok && paramRequirement.defaultValue != nil {
+		return *paramRequirement.defaultValue, true
+	}
+	return "", false
+}
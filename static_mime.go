@@ -0,0 +1,150 @@
+package uhttp
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// built-in content-types of static files by extension, charsets are added according to the charset policy
+// (see WithStaticCharset). Files with other extensions are sniffed with http.DetectContentType
+var staticMimeTypes = map[string]string{
+	// text
+	".html": "text/html",
+	".htm":  "text/html",
+	".css":  "text/css",
+	".js":   "text/javascript",
+	".mjs":  "text/javascript",
+	".cjs":  "text/javascript",
+	".txt":  "text/plain",
+	".md":   "text/markdown",
+	".csv":  "text/csv",
+	".ics":  "text/calendar",
+	".vtt":  "text/vtt",
+
+	// structured data
+	".json":        "application/json",
+	".map":         "application/json",
+	".jsonld":      "application/ld+json",
+	".webmanifest": "application/manifest+json",
+	".xml":         "application/xml",
+	".rss":         "application/rss+xml",
+	".atom":        "application/atom+xml",
+	".yaml":        "application/yaml",
+	".yml":         "application/yaml",
+
+	// applications and documents
+	".wasm": "application/wasm",
+	".pdf":  "application/pdf",
+
+	// images
+	".svg":  "image/svg+xml",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".avif": "image/avif",
+	".jxl":  "image/jxl",
+	".ico":  "image/x-icon",
+	".bmp":  "image/bmp",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+
+	// fonts
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".eot":   "application/vnd.ms-fontobject",
+
+	// audio and video
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".webm": "video/webm",
+	".ogv":  "video/ogg",
+	".mov":  "video/quicktime",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/opus",
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+
+	// archives
+	".zip": "application/zip",
+	".gz":  "application/gzip",
+	".tgz": "application/gzip",
+	".bz2": "application/x-bzip2",
+	".xz":  "application/x-xz",
+	".zst": "application/zstd",
+	".7z":  "application/x-7z-compressed",
+	".rar": "application/vnd.rar",
+	".tar": "application/x-tar",
+}
+
+// staticContentType by extension (user overrides first) or sniffed from the content
+func (s *staticFiles) contentType(name string, content []byte) string {
+	ext := strings.ToLower(path.Ext(name))
+	contentType, ok := s.opts.mimeTypes[ext]
+	if !ok {
+		contentType, ok = staticMimeTypes[ext]
+	}
+	if !ok {
+		// sniffed text types already carry a charset
+		return http.DetectContentType(content)
+	}
+	return withCharset(contentType, s.opts.charset)
+}
+
+// withCharset adds the charset to textual types without one ("" disables the policy)
+func withCharset(contentType string, charset string) string {
+	if charset == "" || !isTextual(contentType) {
+		return contentType
+	}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if _, ok := params["charset"]; ok {
+			return contentType
+		}
+	}
+	return contentType + "; charset=" + charset
+}
+
+func mediaType(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// isTextual is true for text/* and structured text like JSON, XML, YAML and JavaScript
+func isTextual(contentType string) bool {
+	mediaType := mediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/yaml", "application/javascript":
+		return true
+	}
+	return false
+}
+
+// isIncompressible is true for types which are compressed already (compressing them again only wastes memory and time)
+func isIncompressible(contentType string) bool {
+	mediaType := mediaType(contentType)
+	switch mediaType {
+	// uncompressed formats
+	case "image/svg+xml", "image/bmp", "image/x-icon", "image/tiff", "audio/wav":
+		return false
+	case "font/woff", "font/woff2",
+		"application/zip", "application/gzip", "application/x-bzip2", "application/x-xz", "application/zstd",
+		"application/x-7z-compressed", "application/vnd.rar":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "image/") || strings.HasPrefix(mediaType, "video/") || strings.HasPrefix(mediaType, "audio/")
+}
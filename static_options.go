@@ -0,0 +1,177 @@
+package uhttp
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// What is served for non-existent files below the prefix of static files
+type StaticFallback string
+
+const (
+	// the index file (single page apps)
+	STATIC_FALLBACK_INDEX StaticFallback = "index"
+	// 404 with a JSON error body
+	STATIC_FALLBACK_NOT_FOUND StaticFallback = "notFound"
+	// a custom handler (see WithStaticFallbackHandler)
+	STATIC_FALLBACK_HANDLER StaticFallback = "handler"
+)
+
+type StaticOption interface {
+	apply(*staticOptions)
+}
+
+type staticOptions struct {
+	// served for all paths below the prefix which do not exist (single page apps)
+	indexFile       string
+	fallback        StaticFallback
+	fallbackHandler http.Handler
+
+	rules                   []StaticRule
+	fingerprintCacheControl string
+
+	// content-types by extension (lowercase, with a leading dot), they take precedence over the built-in ones
+	mimeTypes map[string]string
+	charset   string
+
+	// see WithStaticLazyLoading
+	lazy               bool
+	memoryBudget       int64
+	streamThreshold    int64
+	streamThresholdSet bool
+
+	// see WithStaticDevMode
+	devMode      bool
+	pollInterval time.Duration
+	watcher      StaticWatcher
+	liveReload   bool
+}
+
+type funcStaticOption struct {
+	f func(*staticOptions)
+}
+
+func (fdo *funcStaticOption) apply(do *staticOptions) {
+	fdo.f(do)
+}
+
+func newFuncStaticOption(f func(*staticOptions)) *funcStaticOption {
+	return &funcStaticOption{f: f}
+}
+
+// in lazy mode larger files would take a lot of memory (and time to compress) for a single request
+const defaultStaticStreamThreshold = 8 << 20
+
+func withStaticDefaults() StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		o.indexFile = "index.html"
+		o.fallback = STATIC_FALLBACK_INDEX
+		o.fingerprintCacheControl = STATIC_CACHE_CONTROL_IMMUTABLE
+		o.mimeTypes = map[string]string{}
+		o.charset = "utf-8"
+	})
+}
+
+// File (relative to the root of the filesystem) which is served for non-existent paths (default: index.html)
+// it must be present if the fallback is STATIC_FALLBACK_INDEX
+func WithStaticIndexFile(name string) StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		o.indexFile = name
+	})
+}
+
+// Fallback policy for non-existent files (default: STATIC_FALLBACK_INDEX)
+func WithStaticFallback(fallback StaticFallback) StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		o.fallback = fallback
+	})
+}
+
+// Non-existent files are served by handler
+func WithStaticFallbackHandler(handler http.Handler) StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		o.fallback = STATIC_FALLBACK_HANDLER
+		o.fallbackHandler = handler
+	})
+}
+
+// Cache-Control and other headers by path, e.g.
+//
+//	StaticRule{Glob: "index.html", CacheControl: "no-cache"}
+//	StaticRule{Regexp: regexp.MustCompile(`^assets/`), Header: http.Header{"X-Content-Type-Options": {"nosniff"}}}
+func WithStaticRules(rules ...StaticRule) StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		o.rules = append(o.rules, rules...)
+	})
+}
+
+// Cache-Control of automatically detected fingerprinted files without a matching rule
+// (default: STATIC_CACHE_CONTROL_IMMUTABLE, "" disables the detection)
+func WithStaticFingerprintCacheControl(cacheControl string) StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		o.fingerprintCacheControl = cacheControl
+	})
+}
+
+// Content-types by extension which override the built-in table, e.g.
+//
+//	map[string]string{".glb": "model/gltf-binary", "wasm": "application/wasm"}
+func WithStaticMimeTypes(mimeTypes map[string]string) StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		for ext, contentType := range mimeTypes {
+			o.mimeTypes["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = contentType
+		}
+	})
+}
+
+// Charset which is added to textual content-types from the table (default: utf-8, "" disables it)
+func WithStaticCharset(charset string) StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		o.charset = charset
+	})
+}
+
+// Lazy mode: files are only indexed on registration, they are loaded and compressed on their first request.
+// Loaded files (including their compressed copies) are kept within memoryBudget bytes, the least recently
+// used ones are evicted first (0: unlimited)
+func WithStaticLazyLoading(memoryBudget int64) StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		o.lazy = true
+		o.memoryBudget = memoryBudget
+	})
+}
+
+// Files larger than size bytes are streamed from the filesystem on every request, they are never loaded
+// into memory or compressed (default: 8 MiB in lazy mode, otherwise 0; 0 disables streaming)
+func WithStaticStreamThreshold(size int64) StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		o.streamThreshold = size
+		o.streamThresholdSet = true
+	})
+}
+
+// Development mode: files are reloaded when they change (the filesystem is rescanned every pollInterval),
+// they are compressed lazily and precompressed siblings are ignored. Not meant for production.
+func WithStaticDevMode(pollInterval time.Duration) StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		o.devMode = true
+		o.pollInterval = pollInterval
+	})
+}
+
+// Development mode with a custom watcher instead of polling (e.g. based on fsnotify)
+func WithStaticWatcher(watcher StaticWatcher) StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		o.devMode = true
+		o.watcher = watcher
+	})
+}
+
+// Reload pages in the browser when files change (development mode only)
+// a script which listens for server-sent events on <prefix>/__uhttp/livereload is injected into all HTML files
+func WithStaticLiveReload() StaticOption {
+	return newFuncStaticOption(func(o *staticOptions) {
+		o.liveReload = true
+	})
+}
@@ -0,0 +1,101 @@
+package uhttp
+
+import (
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Cache-Control for fingerprinted static files (e.g. main.3f2a9c1b.js), their content never changes
+const STATIC_CACHE_CONTROL_IMMUTABLE = "public, max-age=31536000, immutable"
+
+// StaticRule adds headers to all static files it matches (see WithStaticRules)
+type StaticRule struct {
+	// path.Match-pattern against the path relative to the prefix, patterns without "/" match the file name
+	Glob string
+	// alternatively: expression against the path relative to the prefix
+	Regexp *regexp.Regexp
+	// the first matching rule with a Cache-Control wins
+	CacheControl string
+	// headers of all matching rules are set (later rules overwrite earlier ones), e.g. Content-Security-Policy
+	Header http.Header
+}
+
+func (r StaticRule) matches(name string) bool {
+	if r.Regexp != nil {
+		return r.Regexp.MatchString(name)
+	}
+	if !strings.Contains(r.Glob, "/") {
+		name = path.Base(name)
+	}
+	matched, _ := path.Match(r.Glob, name)
+	return matched
+}
+
+// staticHeaders of a file (relative to the root of the filesystem) according to the rules
+// fingerprinted files get fingerprintCacheControl unless a rule sets Cache-Control
+func staticHeaders(name string, rules []StaticRule, fingerprintCacheControl string) http.Header {
+	header := http.Header{}
+	for _, rule := range rules {
+		if !rule.matches(name) {
+			continue
+		}
+		if rule.CacheControl != "" && header.Get(HEADER_CACHE_CONTROL) == "" {
+			header.Set(HEADER_CACHE_CONTROL, rule.CacheControl)
+		}
+		for key, values := range rule.Header {
+			header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	if header.Get(HEADER_CACHE_CONTROL) == "" && fingerprintCacheControl != "" && isFingerprinted(name) {
+		header.Set(HEADER_CACHE_CONTROL, fingerprintCacheControl)
+	}
+	return header
+}
+
+var (
+	fingerprintToken    = regexp.MustCompile(`^[A-Za-z0-9_]{8,64}$`)
+	fingerprintHexToken = regexp.MustCompile(`^[0-9a-f]+$`)
+)
+
+// isFingerprinted detects content-hashes in file names as generated by common bundlers
+// (main.3f2a9c1b.js, index-B4x9aZkQ.js): the last part of the name before the extension is a token
+// of 8 or more characters which mixes letters and digits
+// - lowercase hex tokens (3f2a9c1b) only need to contain both
+// - other tokens have to switch between letters and digits at least 3 times, words and numbers
+// (SemiBold, 20240115, Regular12, Roboto2023Bold) must not be treated as hashes
+// other naming schemes can be covered with a StaticRule
+func isFingerprinted(name string) bool {
+	base := path.Base(name)
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if ext == "" || stem == "" {
+		return false
+	}
+
+	token := stem[strings.LastIndexAny(stem, ".-")+1:]
+	if token == stem || !fingerprintToken.MatchString(token) {
+		return false
+	}
+
+	letters, digits, switches := 0, 0, 0
+	for i, c := range token {
+		if c == '_' {
+			continue
+		}
+		digit := c >= '0' && c <= '9'
+		if digit {
+			digits++
+		} else {
+			letters++
+		}
+		if i > 0 && token[i-1] != '_' && digit != (token[i-1] >= '0' && token[i-1] <= '9') {
+			switches++
+		}
+	}
+	if letters == 0 || digits == 0 {
+		return false
+	}
+	return fingerprintHexToken.MatchString(token) || switches >= 3
+}
@@ -0,0 +1 @@
+console.log("embedded")
\ No newline at end of file
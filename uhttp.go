@@ -1,6 +1,7 @@
 package uhttp
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -25,32 +26,54 @@ type UHTTP struct {
 	metrics         map[string]interface{}
 
 	// hold handle to all caches for calculating total and management
-	cache     map[string]*cache.Cache
-	cacheLock *sync.RWMutex
+	cache             map[string]*cache.Cache
+	cacheLock         *sync.RWMutex
+	cacheGlobalBudget *cache.GlobalBudget
+	cacheFlights      map[string]*cacheFlightGroup
+
+	// identifies this instance on the cache invalidation bus
+	instanceID string
+
+	// static files by prefix
+	static     map[string]*staticFiles
+	staticLock *sync.RWMutex
+
+	// servers started by ListenAndServe (see Shutdown)
+	servers     []*http.Server
+	serversLock *sync.Mutex
+
+	// background loops (cache TTL and snapshots) run until Shutdown closes stop
+	stop       chan struct{}
+	stopOnce   *sync.Once
+	background *sync.WaitGroup
 }
 
 func NewUHTTP(opts ...UhttpOption) *UHTTP {
 	mergedOpts := &uhttpOptions{
-		cors:                    "*",
-		log:                     NewDiscardLogger(),
-		logEncodingError:        func(string, ...interface{}) {},
-		logParseModelError:      func(string, ...interface{}) {},
-		logHandlerError:         func(string, ...interface{}) {},
-		sendPanicInfoToClient:   false,
-		serveMux:                http.NewServeMux(),
-		address:                 "0.0.0.0:8080",
-		readTimeout:             30 * time.Second,
-		readHeaderTimeout:       30 * time.Second,
-		writeTimeout:            30 * time.Second,
-		idleTimeout:             30 * time.Second,
-		enableMetrics:           false,
-		metricsPath:             "/metrics",
-		enableGzip:              true,
-		gzipCompressionLevel:    gzip.BestCompression,
-		enableBrotli:            true,
-		brotliCompressionLevel:  11,
-		enableDeflate:           true,
-		deflateCompressionLevel: flate.BestCompression,
+		cors:                     "*",
+		log:                      NewDiscardLogger(),
+		logEncodingError:         func(string, ...interface{}) {},
+		logParseModelError:       func(string, ...interface{}) {},
+		logHandlerError:          func(string, ...interface{}) {},
+		sendPanicInfoToClient:    false,
+		serveMux:                 http.NewServeMux(),
+		address:                  "0.0.0.0:8080",
+		readTimeout:              30 * time.Second,
+		readHeaderTimeout:        30 * time.Second,
+		writeTimeout:             30 * time.Second,
+		idleTimeout:              30 * time.Second,
+		enableMetrics:            false,
+		metricsPath:              "/metrics",
+		enableGzip:               true,
+		gzipCompressionLevel:     gzip.BestCompression,
+		enableBrotli:             true,
+		brotliCompressionLevel:   11,
+		enableDeflate:            true,
+		deflateCompressionLevel:  flate.BestCompression,
+		enableZstd:               false,
+		zstdCompressionLevel:     3,
+		dynamicCompressionLevels: defaultDynamicCompressionLevels,
+		compressionMinSize:       defaultCompressionMinSize,
 
 		silentStaticFileRegistration: false,
 		logHandlerCalls:              true,
@@ -69,6 +92,18 @@ func NewUHTTP(opts ...UhttpOption) *UHTTP {
 		requestContext: map[ContextKey]interface{}{},
 		cache:          map[string]*cache.Cache{},
 		cacheLock:      &sync.RWMutex{},
+		cacheFlights:   map[string]*cacheFlightGroup{},
+		instanceID:     newInstanceID(),
+		static:         map[string]*staticFiles{},
+		staticLock:     &sync.RWMutex{},
+		serversLock:    &sync.Mutex{},
+		stop:           make(chan struct{}),
+		stopOnce:       &sync.Once{},
+		background:     &sync.WaitGroup{},
+	}
+
+	if mergedOpts.cacheGlobalBudget != nil {
+		u.cacheGlobalBudget = cache.NewGlobalBudget(*mergedOpts.cacheGlobalBudget)
 	}
 
 	if mergedOpts.enableMetrics {
@@ -88,6 +123,13 @@ func NewUHTTP(opts ...UhttpOption) *UHTTP {
 			Buckets:   []float64{1, 100, 500, 1000, 5000, 10000, 60000},
 		}, []string{"method", "code", "handler"})
 
+		metrics[Metric_Cache_Evictions] = promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "uhttp",
+			Subsystem: "cache",
+			Name:      "evictions",
+			Help:      "evicted cache entries",
+		}, []string{"handler"})
+
 		u.metrics = metrics
 		u.metricsServeMux = http.NewServeMux()
 	}
@@ -181,25 +223,24 @@ func (u *UHTTP) ListenAndServe() error {
 		}
 	}
 
+	u.serversLock.Lock()
+	u.servers = append(u.servers, srv)
+	if metricsServer != nil {
+		u.servers = append(u.servers, metricsServer)
+	}
+	u.serversLock.Unlock()
+
 	// Execute TTL for cache (a handler will never serve a cache which is too old, this routine only
 	// makes sure that the cache size does not grow too much)
-	go func() {
-		for {
-			u.cacheLock.RLock()
-			for _, patternCache := range u.cache {
-				keys := patternCache.Keys()
-				for _, key := range keys {
-					if entry, ok := patternCache.GetByKey(key); ok {
-						if time.Since(entry.UpdatedOn()) > patternCache.MaxAge() {
-							patternCache.Delete(key)
-						}
-					}
-				}
+	u.runInBackground(u.opts.cacheTTLEnforcerInterval, u.enforceCacheTTL)
+
+	if u.opts.cacheSnapshotDir != "" && u.opts.cacheSnapshotInterval > 0 {
+		u.runInBackground(u.opts.cacheSnapshotInterval, func() {
+			if err := u.SnapshotCaches(); err != nil {
+				u.Log().Errorf("%s", err)
 			}
-			u.cacheLock.RUnlock()
-			time.Sleep(u.opts.cacheTTLEnforcerInterval)
-		}
-	}()
+		})
+	}
 
 	if !u.opts.enableTLS {
 		if u.opts.enableMetrics {
@@ -222,3 +263,72 @@ func (u *UHTTP) ListenAndServe() error {
 	u.Log().Infof("ServingTLS at %s", u.opts.address)
 	return srv.ListenAndServeTLS(*u.opts.tlsCertPath, *u.opts.tlsKeyPath)
 }
+
+// Shutdown stops the servers gracefully (see http.Server.Shutdown, ListenAndServe returns http.ErrServerClosed),
+// stops the cache TTL enforcer and periodic snapshots, snapshots all caches a final time (if configured,
+// see WithCacheSnapshots) and detaches them from the invalidation bus
+func (u *UHTTP) Shutdown(ctx context.Context) error {
+	u.serversLock.Lock()
+	servers := u.servers
+	u.servers = nil
+	u.serversLock.Unlock()
+
+	errs := []error{}
+	for _, srv := range servers {
+		errs = append(errs, srv.Shutdown(ctx))
+	}
+
+	// neither the TTL enforcer nor a periodic snapshot may touch the caches after the final snapshot
+	u.stopOnce.Do(func() { close(u.stop) })
+	u.background.Wait()
+
+	// no requests are served anymore, so the snapshot contains everything
+	if u.opts.cacheSnapshotDir != "" {
+		errs = append(errs, u.SnapshotCaches())
+	}
+
+	u.cacheLock.RLock()
+	for _, c := range u.cache {
+		c.Close()
+	}
+	u.cacheLock.RUnlock()
+
+	return errors.Join(errs...)
+}
+
+// runInBackground executes f every interval until Shutdown (not at all for intervals <= 0)
+func (u *UHTTP) runInBackground(interval time.Duration, f func()) {
+	if interval <= 0 {
+		return
+	}
+	u.background.Add(1)
+	go func() {
+		defer u.background.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-u.stop:
+				return
+			case <-ticker.C:
+				f()
+			}
+		}
+	}()
+}
+
+// enforceCacheTTL deletes all entries which are older than their retention
+func (u *UHTTP) enforceCacheTTL() {
+	u.cacheLock.RLock()
+	defer u.cacheLock.RUnlock()
+	for _, patternCache := range u.cache {
+		keys := patternCache.Keys()
+		for _, key := range keys {
+			if entry, ok := patternCache.GetByKey(key); ok {
+				if time.Since(entry.UpdatedOn()) > patternCache.EntryRetention(entry) {
+					patternCache.Delete(key)
+				}
+			}
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/dunv/uhttp/cache"
 	"github.com/klauspost/compress/flate"
 	"github.com/klauspost/compress/gzip"
 )
@@ -41,8 +42,13 @@ type uhttpOptions struct {
 	gzipCompressionLevel    int
 	enableBrotli            bool
 	brotliCompressionLevel  int
+	enableZstd              bool
+	zstdCompressionLevel    int
 	enableDeflate           bool
 	deflateCompressionLevel int
+	// levels above are used for content which is compressed once (static files, persisted cache-encodings)
+	dynamicCompressionLevels CompressionLevels
+	compressionMinSize       int
 
 	// Logging
 	silentStaticFileRegistration bool
@@ -60,6 +66,11 @@ type uhttpOptions struct {
 
 	// Caching
 	cacheTTLEnforcerInterval time.Duration
+	cacheStore               func(handlerPattern string) cache.Store
+	cacheGlobalBudget        *cache.Budget
+	cacheInvalidationBus     cache.InvalidationBus
+	cacheSnapshotDir         string
+	cacheSnapshotInterval    time.Duration
 
 	// Granular logging
 	logHandlerCalls                 bool
@@ -118,6 +129,20 @@ func WithBrotliCompression(enable bool, level int) UhttpOption {
 	})
 }
 
+// zstd is disabled by default, if enabled it is preferred over all other encodings
+// levels are the ones of the zstd command line (1-22)
+func WithZstdCompression(enable bool, level int) UhttpOption {
+	return newFuncUhttpOption(func(o *uhttpOptions) {
+		o.enableZstd = enable
+		if level < 1 {
+			level = 1
+		} else if level > 22 {
+			level = 22
+		}
+		o.zstdCompressionLevel = level
+	})
+}
+
 func WithDeflateCompression(enable bool, level int) UhttpOption {
 	return newFuncUhttpOption(func(o *uhttpOptions) {
 		o.enableDeflate = enable
@@ -130,6 +155,26 @@ func WithDeflateCompression(enable bool, level int) UhttpOption {
 	})
 }
 
+// Levels for responses which are compressed for every request and the size (in bytes) below which
+// responses are not compressed at all (default: DefaultDynamicCompressionLevels() and 1 KiB)
+// unset levels are taken from DefaultDynamicCompressionLevels()
+// the levels of WithBrotliCompression etc. are used for static files and persisted cache-encodings
+func WithDynamicCompression(levels CompressionLevels, minSize int) UhttpOption {
+	return newFuncUhttpOption(func(o *uhttpOptions) {
+		o.dynamicCompressionLevels = levels.merged(defaultDynamicCompressionLevels).clamped()
+		o.compressionMinSize = minSize
+	})
+}
+
+func (o *uhttpOptions) staticCompressionLevels() CompressionLevels {
+	return CompressionLevels{
+		Brotli:  o.brotliCompressionLevel,
+		Gzip:    o.gzipCompressionLevel,
+		Deflate: o.deflateCompressionLevel,
+		Zstd:    o.zstdCompressionLevel,
+	}
+}
+
 func WithLogEncodingError(fn func(template string, args ...interface{})) UhttpOption {
 	return newFuncUhttpOption(func(o *uhttpOptions) {
 		o.logEncodingError = fn
@@ -232,6 +277,39 @@ func WithCacheTTLEnforcerInterval(i time.Duration) UhttpOption {
 	})
 }
 
+// Store which is used by all caches (unless a handler specifies WithCacheStore)
+// e.g. a cache.NewSerializedStore on top of a shared backend, so replicas can share their caches
+func WithDefaultCacheStore(store func(handlerPattern string) cache.Store) UhttpOption {
+	return newFuncUhttpOption(func(o *uhttpOptions) {
+		o.cacheStore = store
+	})
+}
+
+// Budget for all caches together, if it is exceeded entries are evicted across all caches
+// according to the policy (cache.EVICTION_LRU or cache.EVICTION_LFU). zero values are unlimited
+func WithGlobalCacheBudget(maxBytes uint64, maxEntries int, policy cache.EvictionPolicy) UhttpOption {
+	return newFuncUhttpOption(func(o *uhttpOptions) {
+		o.cacheGlobalBudget = &cache.Budget{MaxBytes: maxBytes, MaxEntries: maxEntries, Policy: policy}
+	})
+}
+
+// Invalidations (UHTTP.Cache() and the clear-handler) are published to the bus and
+// all caches apply the invalidations of other instances (e.g. replicas)
+func WithCacheInvalidationBus(bus cache.InvalidationBus) UhttpOption {
+	return newFuncUhttpOption(func(o *uhttpOptions) {
+		o.cacheInvalidationBus = bus
+	})
+}
+
+// Caches are restored from snapshots in dir when their handler is registered (expired entries are dropped)
+// and snapshotted at the interval and on UHTTP.Shutdown (0: only on shutdown or when calling UHTTP.SnapshotCaches)
+func WithCacheSnapshots(dir string, interval time.Duration) UhttpOption {
+	return newFuncUhttpOption(func(o *uhttpOptions) {
+		o.cacheSnapshotDir = dir
+		o.cacheSnapshotInterval = interval
+	})
+}
+
 func WithLogCustomMiddlewareRegistration() UhttpOption {
 	return newFuncUhttpOption(func(o *uhttpOptions) {
 		o.logCustomMiddlewareRegistration = true
@@ -15,6 +15,7 @@ import (
 	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/flate"
 	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
 
 	"github.com/spf13/cobra"
 )
@@ -27,10 +28,11 @@ var precompressStaticFilesCmd = &cobra.Command{
 		addGzip, _ := cmd.Flags().GetBool("gzip")
 		addBrotli, _ := cmd.Flags().GetBool("brotli")
 		addDeflate, _ := cmd.Flags().GetBool("deflate")
+		addZstd, _ := cmd.Flags().GetBool("zstd")
 
 		fileNames := []string{}
 		err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
-			if path != rootDir && !info.IsDir() && !strings.HasSuffix(path, ".brotli") && !strings.HasSuffix(path, ".gz") && !strings.HasSuffix(path, "deflate") {
+			if path != rootDir && !info.IsDir() && !strings.HasSuffix(path, ".brotli") && !strings.HasSuffix(path, ".gz") && !strings.HasSuffix(path, "deflate") && !strings.HasSuffix(path, ".zst") {
 				fileNames = append(fileNames, path)
 			}
 			return nil
@@ -115,6 +117,28 @@ var precompressStaticFilesCmd = &cobra.Command{
 				}
 				fmt.Printf("Compressed with deflate : %s -> %s.deflate (%s)\n", file, file, time.Since(start))
 			}
+			if addZstd {
+				buffer.Reset()
+				zstdWriter, err := zstd.NewWriter(&buffer, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+				if err != nil {
+					return err
+				}
+				start := time.Now()
+				fileContent, err := os.ReadFile(file)
+				if err != nil {
+					return err
+				}
+				if _, err := zstdWriter.Write(fileContent); err != nil {
+					return err
+				}
+				if err := zstdWriter.Close(); err != nil {
+					return err
+				}
+				if err := os.WriteFile(fmt.Sprintf("%s.zst", file), buffer.Bytes(), 0664); err != nil {
+					return err
+				}
+				fmt.Printf("Compressed with zstd: %s -> %s.zst (%s)\n", file, file, time.Since(start))
+			}
 		}
 
 		return nil
@@ -130,6 +154,7 @@ func init() {
 	precompressStaticFilesCmd.Flags().Bool("gzip", false, "add gzip")
 	precompressStaticFilesCmd.Flags().Bool("brotli", false, "add brotli")
 	precompressStaticFilesCmd.Flags().Bool("deflate", false, "add deflate")
+	precompressStaticFilesCmd.Flags().Bool("zstd", false, "add zstd")
 
 	rootCmd.AddCommand(precompressStaticFilesCmd)
 }